@@ -0,0 +1,216 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// SetMultiPV sets the number of lines the engine reports per search with its
+// MultiPV option and remembers it, so RankedLines knows how many ranks to
+// expect. n must be at least 1, and within the option's range if the engine
+// has advertised it
+func (e *Engine) SetMultiPV(n int) error {
+	if n < 1 {
+		return fmt.Errorf("%w: MultiPV must be at least 1, is %d", ErrOptionInvalid, n)
+	}
+
+	o := EngOption{Name: "MultiPV", Value: strconv.Itoa(n)}
+
+	e.RLock()
+	err := e.validateOption(o)
+	e.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := e.SendOption(o.Name, o.Value); err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.multiPV = n
+
+	return nil
+}
+
+// MultiPV returns the number of lines per search set with SetMultiPV, or 0 if
+// it has not been called
+func (e *Engine) MultiPV() int {
+	e.RLock()
+	defer e.RUnlock()
+
+	return e.multiPV
+}
+
+// RankedLines returns the latest info line for each multipv rank sorted by
+// rank (1..N), all taken from the deepest depth for which every rank has
+// reported a line. If no depth is complete yet, the deepest depth seen is
+// used instead
+//
+// Only info lines carrying a pv are considered. Lines without multipv set are
+// treated as rank 1. If the number of lines was set with SetMultiPV, ranks
+// beyond it are left out, e.g. stale lines from before MultiPV was lowered
+func (e *Engine) RankedLines() []Info {
+	e.RLock()
+	defer e.RUnlock()
+
+	// latest info per rank, grouped by depth
+	byDepth := map[int]map[int]Info{}
+	maxRank := 0
+
+	for _, info := range e.infoBuf {
+		if len(info.PV) == 0 {
+			continue
+		}
+
+		rank := info.MultiPV
+		if rank == 0 {
+			rank = 1
+		}
+		if e.multiPV > 0 && rank > e.multiPV {
+			continue
+		}
+
+		if rank > maxRank {
+			maxRank = rank
+		}
+
+		if byDepth[info.Depth] == nil {
+			byDepth[info.Depth] = map[int]Info{}
+		}
+		byDepth[info.Depth][rank] = info
+	}
+
+	if len(byDepth) == 0 {
+		return []Info{}
+	}
+
+	depths := make([]int, 0, len(byDepth))
+	for d := range byDepth {
+		depths = append(depths, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(depths)))
+
+	// find the deepest depth where all ranks are present
+	depth := depths[0]
+	for _, d := range depths {
+		if len(byDepth[d]) == maxRank {
+			depth = d
+			break
+		}
+	}
+
+	ret := make([]Info, 0, len(byDepth[depth]))
+	for _, info := range byDepth[depth] {
+		ret = append(ret, info)
+	}
+
+	rankOf := func(i Info) int {
+		if i.MultiPV == 0 {
+			return 1
+		}
+		return i.MultiPV
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return rankOf(ret[i]) < rankOf(ret[j])
+	})
+
+	return ret
+}
+
+// DepthStat holds search statistics for a completed depth
+type DepthStat struct {
+	Depth  int   // search depth in plies
+	Time   int64 // time searched when the depth completed, in ms
+	Nodes  int64 // nodes searched when the depth completed
+	NPS    int64 // nodes per second, computed from Nodes and Time
+	TBHits int64 // endgame table base hits when the depth completed
+	SBHits int64 // shredder endgame database hits when the depth completed
+}
+
+// DepthTimeline returns statistics for each completed depth in increasing
+// order of depth, taken from the last main line (multipv 1) reported at that
+// depth. This gives time-to-depth and, from consecutive node counts, the
+// effective branching factor of the search, and the growth of table base
+// hits with depth
+//
+// Lines with a lowerbound or upperbound score, reporting a fail high or low
+// partway through a depth, are skipped. The deepest depth only counts as
+// completed once a bestmove has been received after the engine started
+// reporting it
+//
+// If the engine did not report a time for a depth, NPS is the engine's own
+// nps value
+func (e *Engine) DepthTimeline() []DepthStat {
+	e.RLock()
+	defer e.RUnlock()
+
+	// the buffer holds the most recent of all info lines parsed
+	first := e.infoTotal - uint64(len(e.infoBuf))
+
+	last := map[int]Info{}
+	started := map[int]uint64{} // number of the first line at each depth
+	deepest := 0
+	for k, info := range e.infoBuf {
+		if len(info.PV) == 0 || info.MultiPV > 1 {
+			continue
+		}
+		if info.Score.Lowerbound || info.Score.Upperbound {
+			continue
+		}
+
+		if _, ok := started[info.Depth]; !ok {
+			started[info.Depth] = first + uint64(k)
+		}
+		last[info.Depth] = info
+		deepest = max(deepest, info.Depth)
+	}
+
+	// the deepest depth is still being searched until a bestmove follows
+	if n, ok := started[deepest]; ok && n >= e.bestMoveAt {
+		delete(last, deepest)
+	}
+
+	ret := make([]DepthStat, 0, len(last))
+	for depth, info := range last {
+		stat := DepthStat{
+			Depth:  depth,
+			Time:   info.Time,
+			Nodes:  info.Nodes,
+			NPS:    info.NodesPerSecond,
+			TBHits: info.TBHits,
+			SBHits: info.SBHits,
+		}
+		if info.Time > 0 {
+			stat.NPS = info.Nodes * 1000 / info.Time
+		}
+
+		ret = append(ret, stat)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Depth < ret[j].Depth
+	})
+
+	return ret
+}
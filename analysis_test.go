@@ -0,0 +1,229 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRankedLines(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng,
+		"info depth 1 multipv 1 score cp 30 pv e2e4",
+		"info depth 1 multipv 2 score cp 20 pv d2d4",
+		"info depth 1 multipv 3 score cp 10 pv g1f3",
+		"info depth 2 multipv 2 score cp 25 pv e2e4 e7e5",
+		"info depth 2 multipv 1 score cp 28 pv d2d4 d7d5",
+		"info depth 2 multipv 3 score cp 15 pv c2c4 e7e5",
+		"info depth 2 multipv 1 score cp 35 pv d2d4 g8f6",
+		// depth 3 has not completed for every rank yet
+		"info depth 3 currmove e2e4 currmovenumber 1",
+		"info depth 3 multipv 1 score cp 40 pv e2e4 c7c5",
+	)
+
+	lines := eng.RankedLines()
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 ranked lines, got %d", len(lines))
+	}
+
+	want := [][]string{
+		{"d2d4", "g8f6"},
+		{"e2e4", "e7e5"},
+		{"c2c4", "e7e5"},
+	}
+
+	for i, l := range lines {
+		if l.MultiPV != i+1 {
+			t.Errorf("line %d: expected multipv %d, got %d", i, i+1, l.MultiPV)
+		}
+		if l.Depth != 2 {
+			t.Errorf("line %d: expected depth 2, got %d", i, l.Depth)
+		}
+		if !reflect.DeepEqual(l.PV, want[i]) {
+			t.Errorf("line %d: expected pv %v, got %v", i, want[i], l.PV)
+		}
+	}
+
+	if lines[0].Score.Val != 35 {
+		t.Errorf("expected latest rank 1 score 35, got %d", lines[0].Score.Val)
+	}
+}
+
+func TestDepthTimeline(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng,
+		"info depth 1 seldepth 1 multipv 1 score cp 20 nodes 20 nps 20000 time 1 pv e2e4",
+		"info depth 2 seldepth 2 multipv 1 score cp 25 nodes 100 nps 50000 time 2 pv e2e4 e7e5",
+		"info depth 3 currmove e2e4 currmovenumber 1",
+		"info depth 3 seldepth 4 multipv 1 score cp 22 upperbound nodes 300 nps 60000 time 5 pv e2e4",
+		"info depth 3 seldepth 4 multipv 2 score cp 10 nodes 450 nps 64285 time 7 pv d2d4",
+		"info depth 3 seldepth 5 multipv 1 score cp 30 nodes 400 nps 66666 time 6 pv e2e4 c7c5 g1f3",
+		"info depth 4 seldepth 6 multipv 1 score cp 28 nodes 2000 time 0 nps 1000000 pv e2e4 c7c5",
+	)
+
+	// depth 4 may still be in progress
+	expected := []DepthStat{
+		{Depth: 1, Time: 1, Nodes: 20, NPS: 20000},
+		{Depth: 2, Time: 2, Nodes: 100, NPS: 50000},
+		{Depth: 3, Time: 6, Nodes: 400, NPS: 66666},
+	}
+
+	if timeline := eng.DepthTimeline(); !reflect.DeepEqual(timeline, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, timeline)
+	}
+
+	// the search is stopped while failing high at depth 5, so depth 4 was
+	// the last completed
+	feedLines(t, eng,
+		"info depth 5 seldepth 7 multipv 1 score cp 45 lowerbound nodes 3000 time 4 pv d2d4",
+		"bestmove e2e4 ponder c7c5",
+	)
+	expected = append(expected, DepthStat{Depth: 4, Time: 0, Nodes: 2000, NPS: 1000000})
+
+	if timeline := eng.DepthTimeline(); !reflect.DeepEqual(timeline, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, timeline)
+	}
+
+	// a depth started after the bestmove is in progress again
+	eng.SetKeepInfoHistory(true)
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	feedLines(t, eng, "info depth 6 seldepth 8 multipv 1 score cp 50 nodes 9000 time 9 pv e2e4")
+
+	if timeline := eng.DepthTimeline(); !reflect.DeepEqual(timeline, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, timeline)
+	}
+}
+
+func TestDepthTimelineTBHits(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng,
+		"info depth 1 score cp 20 nodes 20 time 1 tbhits 0 pv e2e4",
+		"info depth 2 score cp 25 nodes 100 time 2 tbhits 3 pv e2e4 e7e5",
+		"info depth 3 multipv 2 score cp 10 nodes 300 time 4 tbhits 90 pv d2d4",
+		"info depth 3 score cp 22 nodes 250 time 3 tbhits 12 sbhits 4 pv e2e4",
+		"info depth 3 score cp 30 nodes 400 time 6 tbhits 40 sbhits 7 pv e2e4 c7c5",
+		"info depth 4 currmove e2e4 currmovenumber 1 tbhits 55",
+		"bestmove e2e4",
+	)
+
+	expected := []DepthStat{
+		{Depth: 1, Time: 1, Nodes: 20, NPS: 20000},
+		{Depth: 2, Time: 2, Nodes: 100, NPS: 50000, TBHits: 3},
+		{Depth: 3, Time: 6, Nodes: 400, NPS: 66666, TBHits: 40, SBHits: 7},
+	}
+
+	if timeline := eng.DepthTimeline(); !reflect.DeepEqual(timeline, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, timeline)
+	}
+}
+
+func TestSetMultiPV(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	if err := eng.SetMultiPV(0); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+	if err := eng.SetMultiPV(3); err != nil {
+		t.Fatal(err)
+	}
+	if stdin.String() != "setoption name MultiPV value 3\n" {
+		t.Errorf("unexpected command %q", stdin.String())
+	}
+	if n := eng.MultiPV(); n != 3 {
+		t.Errorf("expected MultiPV 3, got %d", n)
+	}
+
+	if err := eng.SetMultiPV(2); err != nil {
+		t.Fatal(err)
+	}
+	if n := eng.MultiPV(); n != 2 {
+		t.Errorf("expected MultiPV 2, got %d", n)
+	}
+
+	// a third rank left over from the earlier setting is ignored
+	feedLines(t, eng,
+		"info depth 1 multipv 3 score cp 10 pv g1f3",
+		"info depth 2 multipv 1 score cp 30 pv e2e4",
+		"info depth 2 multipv 2 score cp 20 pv d2d4",
+	)
+	if lines := eng.RankedLines(); len(lines) != 2 || lines[0].Depth != 2 {
+		t.Errorf("expected 2 ranked lines at depth 2, got %+v", lines)
+	}
+
+	// the option's range is checked once the engine has advertised it
+	eng, _ = newOptionsTestEngine(t)
+	if err := eng.SetMultiPV(501); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+	if n := eng.MultiPV(); n != 0 {
+		t.Errorf("expected MultiPV to be unset, got %d", n)
+	}
+}
+
+func TestGetInfoMultiPV(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng,
+		"info depth 1 multipv 1 score cp 30 pv e2e4",
+		"info depth 1 multipv 2 score cp 20 pv d2d4",
+		"info depth 2 currmove e2e4 currmovenumber 1",
+		"info depth 2 multipv 1 score cp 28 pv d2d4 d7d5",
+		"info depth 2 multipv 2 score cp 25 pv e2e4 e7e5",
+		"info depth 3 multipv 2 score cp 22 pv e2e4 c7c5",
+		"info depth 3 multipv 1 score cp 35 pv d2d4 g8f6",
+	)
+
+	second := eng.GetInfoMultiPV(2, -1)
+	if len(second) != 3 {
+		t.Fatalf("expected 3 lines for rank 2, got %d", len(second))
+	}
+	for i, info := range second {
+		if info.MultiPV != 2 || info.Depth != i+1 {
+			t.Errorf("line %d: unexpected %+v", i, info)
+		}
+	}
+
+	if lines := eng.GetInfoMultiPV(2, 1); len(lines) != 1 || lines[0].Score.Val != 22 {
+		t.Errorf("expected the last rank 2 line, got %+v", lines)
+	}
+	if lines := eng.GetInfoMultiPV(1, 10); len(lines) != 3 {
+		t.Errorf("expected every rank 1 line, got %+v", lines)
+	}
+	if lines := eng.GetInfoMultiPV(3, -1); len(lines) != 0 {
+		t.Errorf("expected no lines for rank 3, got %+v", lines)
+	}
+
+	// lines without multipv are rank 1
+	eng, _ = newTestEngine()
+	feedLines(t, eng, "info depth 1 score cp 10 pv e2e4")
+	if lines := eng.GetInfoMultiPV(1, -1); len(lines) != 1 {
+		t.Errorf("expected 1 line, got %+v", lines)
+	}
+
+	// asking for more lines than were received
+	if lines := eng.GetInfo(5); len(lines) != 1 {
+		t.Errorf("expected 1 line, got %+v", lines)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// how long Bench waits for the engine to finish its benchmark
+	defaultBenchTimeout = 10 * time.Minute
+)
+
+// BenchResult is the summary of an engine benchmark
+type BenchResult struct {
+	Nodes int64         // nodes searched over the whole benchmark
+	NPS   int64         // nodes searched per second
+	Time  time.Duration // time the benchmark took, if the engine reports it
+
+	// every line the engine sent while benchmarking
+	Output []string
+}
+
+// BenchParser reads the output of an engine's bench command one line at a
+// time, filling in r from the lines of the summary. It returns true once the
+// summary is complete, which ends the benchmark
+type BenchParser func(line string, r *BenchResult) bool
+
+// StockfishBench is the BenchParser for Stockfish and engines printing the
+// same summary, which ends the benchmark with
+//
+//	Total time (ms) : 2847
+//	Nodes searched  : 2330010
+//	Nodes/second    : 818408
+//
+// Stockfish writes the summary to stderr, so the engine must be started with
+// EngineOptions.MergeStderr for Bench to see it
+func StockfishBench(line string, r *BenchResult) bool {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return false
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	switch strings.TrimSpace(key) {
+	case "Total time (ms)":
+		r.Time = time.Duration(n) * time.Millisecond
+	case "Nodes searched":
+		r.Nodes = n
+	case "Nodes/second":
+		r.NPS = n
+		return true
+	}
+
+	return false
+}
+
+// lineCapture receives every line of engine output until done is closed
+type lineCapture struct {
+	lines chan string
+	done  chan struct{}
+}
+
+// sends a line of engine output to the capture, if there is one, returning
+// true if there is
+func (e *Engine) captureLine(line string) bool {
+	c := e.capture.Load()
+	if c == nil {
+		return false
+	}
+
+	select {
+	case c.lines <- line:
+	case <-c.done:
+	}
+
+	return true
+}
+
+// Bench runs the engine's benchmark by sending bench followed by args, e.g.
+// "16", "1", "13" for Stockfish's hash size, threads and depth, and returns
+// the nodes searched and speed from its summary, parsed with StockfishBench.
+// It waits up to 10 minutes for the benchmark to finish
+//
+// Stockfish writes the summary to stderr, so the engine must be started with
+// EngineOptions.MergeStderr, or Bench times out after the 10 minutes
+func (e *Engine) Bench(args ...string) (BenchResult, error) {
+	return e.BenchWith(StockfishBench, defaultBenchTimeout, args...)
+}
+
+// BenchWith is like Bench, but parses the engine's output with parse, for
+// engines whose summary differs from Stockfish's, and waits up to timeout
+//
+// A benchmark cannot run during a search. The info lines and bestmoves the
+// engine sends while benchmarking are stored as usual, but the bestmoves are
+// not returned by WaitBestMove. Other lines, such as the summary, only reach
+// parse
+func (e *Engine) BenchWith(parse BenchParser, timeout time.Duration, args ...string) (BenchResult, error) {
+	c := &lineCapture{
+		lines: make(chan string, subscriberChanSize),
+		done:  make(chan struct{}),
+	}
+
+	e.RLock()
+	searching := len(e.searches) > 0
+	e.RUnlock()
+	if searching {
+		return BenchResult{}, ErrSearchInProgress
+	}
+	if !e.capture.CompareAndSwap(nil, c) {
+		return BenchResult{}, errors.New("a benchmark is already running")
+	}
+
+	defer func() {
+		e.capture.Store(nil)
+		close(c.done)
+
+		// the bestmoves of the benchmark's searches answer no search
+		for {
+			select {
+			case <-e.chans.bestMove:
+			default:
+				return
+			}
+		}
+	}()
+
+	cmd := strings.Join(append([]string{"bench"}, args...), " ")
+	if err := e.SendCommand(cmd); err != nil {
+		return BenchResult{}, err
+	}
+
+	var r BenchResult
+	timer := time.After(timeout)
+
+	for {
+		select {
+		case line := <-c.lines:
+			r.Output = append(r.Output, line)
+			if parse(line, &r) {
+				return r, nil
+			}
+		case <-e.exited:
+			return r, fmt.Errorf("bench: %w", ErrEngineExited)
+		case <-timer:
+			return r, fmt.Errorf("waiting for bench: %w", ErrTimeout)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStockfishBench(t *testing.T) {
+	f, err := os.Open("testdata/stockfish-bench.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r BenchResult
+	done := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if done {
+			t.Fatalf("expected the summary to end the output, got %q after it", s.Text())
+		}
+		done = StockfishBench(s.Text(), &r)
+	}
+	if !done {
+		t.Fatal("expected the summary to be found")
+	}
+
+	if r.Nodes != 282358 || r.NPS != 1161967 || r.Time != 243*time.Millisecond {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
+
+func TestBench(t *testing.T) {
+	eng, err := NewEngineWithOptions(os.Args[0], EngineOptions{MergeStderr: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	// after the handshake, stray lines are no longer kept as the banner
+	if err = eng.UCI(); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged bytes.Buffer
+	eng.SetLogger(slog.New(slog.NewTextHandler(&logged, nil)))
+
+	r, err := eng.Bench("16", "1", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Nodes != 42 || r.NPS != 21000 || r.Time != 2*time.Millisecond {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if len(r.Output) == 0 || !strings.HasPrefix(r.Output[0], "Position: 1/2") {
+		t.Errorf("expected the output to be captured, got %q", r.Output)
+	}
+
+	// only the info lines of the benchmark's searches are parsed as such
+	var depths []int
+	for _, info := range eng.GetInfo(-1) {
+		if len(info.Extra) != 0 {
+			t.Errorf("expected no other output in the info buffer, got %q", info.Raw)
+		}
+		depths = append(depths, info.Depth)
+	}
+	if !reflect.DeepEqual(depths, []int{1, 1}) {
+		t.Errorf("expected the info lines of both searches, got depths %v", depths)
+	}
+	if err = eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("expected nothing to be logged, got:\n%s", logged.String())
+	}
+
+	// the benchmark's bestmoves do not answer a search
+	if b, err := eng.WaitBestMove(50 * time.Millisecond); err == nil {
+		t.Errorf("expected no bestmove, got %+v", b)
+	}
+
+	// the engine is still usable afterwards
+	if err = eng.Go(GoParams{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBenchWith(t *testing.T) {
+	// without stderr the Stockfish summary never arrives
+	eng := newMockEngine(t)
+	if _, err := eng.BenchWith(StockfishBench, 200*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// a parser for an engine that ends its benchmark differently
+	positions := 0
+	r, err := eng.BenchWith(func(line string, r *BenchResult) bool {
+		if strings.HasPrefix(line, "bestmove") {
+			positions++
+		}
+		return positions == 2
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Output); n != 6 {
+		t.Errorf("expected 6 lines of output, got %d: %q", n, r.Output)
+	}
+
+	// no benchmark during a search
+	if err = eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = eng.Bench(); !errors.Is(err, ErrSearchInProgress) {
+		t.Errorf("expected ErrSearchInProgress, got %v", err)
+	}
+	if _, err = eng.StopAndWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
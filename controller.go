@@ -0,0 +1,44 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"time"
+)
+
+// Controller is the set of Engine methods needed to drive an engine through
+// the UCI protocol. Code that depends on a Controller rather than an *Engine
+// can be tested with a fake engine
+type Controller interface {
+	UCI() error
+	SendCommand(command string) error
+	SendOption(name, value string) error
+	SendUCINewGame() error
+	SendStartPos() error
+	SendFEN(fen string) error
+	Go(p GoParams) error
+	SendStop() error
+	SendPonderHit() error
+	WaitReadyOK(timeout time.Duration) error
+	WaitBestMove(timeout time.Duration) (BestMove, error)
+	GetInfo(last int) []Info
+	SendQuit() error
+	Close() error
+}
+
+var _ Controller = (*Engine)(nil)
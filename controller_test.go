@@ -0,0 +1,97 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeController records commands and answers every search with a fixed
+// bestmove
+type fakeController struct {
+	commands []string
+	best     BestMove
+}
+
+func (f *fakeController) UCI() error               { return f.SendCommand("uci") }
+func (f *fakeController) SendUCINewGame() error    { return f.SendCommand("ucinewgame") }
+func (f *fakeController) SendStartPos() error      { return f.SendCommand("position startpos") }
+func (f *fakeController) SendFEN(fen string) error { return f.SendCommand("position fen " + fen) }
+func (f *fakeController) Go(p GoParams) error      { return f.SendCommand(p.String()) }
+func (f *fakeController) SendStop() error          { return f.SendCommand("stop") }
+func (f *fakeController) SendPonderHit() error     { return f.SendCommand("ponderhit") }
+func (f *fakeController) SendQuit() error          { return f.SendCommand("quit") }
+func (f *fakeController) Close() error             { return nil }
+func (f *fakeController) GetInfo(last int) []Info  { return nil }
+
+func (f *fakeController) SendCommand(command string) error {
+	f.commands = append(f.commands, command)
+	return nil
+}
+
+func (f *fakeController) SendOption(name, value string) error {
+	return f.SendCommand("setoption name " + name + " value " + value)
+}
+
+func (f *fakeController) WaitReadyOK(timeout time.Duration) error {
+	return nil
+}
+
+func (f *fakeController) WaitBestMove(timeout time.Duration) (BestMove, error) {
+	return f.best, nil
+}
+
+// a consumer of the package that only depends on a Controller
+func bestMoveAtDepth(c Controller, depth int) (string, error) {
+	if err := c.SendStartPos(); err != nil {
+		return "", err
+	}
+	if err := c.Go(GoParams{Depth: depth}); err != nil {
+		return "", err
+	}
+
+	b, err := c.WaitBestMove(time.Second)
+	return b.BestMove, err
+}
+
+func TestController(t *testing.T) {
+	fake := &fakeController{best: BestMove{BestMove: "g1f3"}}
+
+	move, err := bestMoveAtDepth(fake, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if move != "g1f3" {
+		t.Fatalf("expected g1f3, got %s", move)
+	}
+
+	expected := []string{"position startpos", "go depth 8"}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Fatalf("expected commands %q, got %q", expected, fake.commands)
+	}
+
+	// the real engine can be used in its place
+	if move, err = bestMoveAtDepth(newMockEngine(t), 2); err != nil {
+		t.Fatal(err)
+	}
+	if move != "e2e4" {
+		t.Fatalf("expected e2e4, got %s", move)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+)
+
+// Errors returned by the package, usually wrapped with more detail. Use
+// errors.Is to check for them
+var (
+	// ErrTimeout means the engine did not respond in time
+	ErrTimeout = errors.New("timed out")
+
+	// ErrChannelNotReady means the engine's internal channels have not been
+	// set up, i.e. the engine was not created with one of the constructors
+	ErrChannelNotReady = errors.New("channel not ready")
+
+	// ErrEngineExited means the engine can no longer be written to because
+	// its process has exited or been closed
+	ErrEngineExited = errors.New("engine exited")
+
+	// ErrOptionInvalid means an option is not supported by the engine or its
+	// value does not suit the option's type
+	ErrOptionInvalid = errors.New("invalid option")
+
+	// ErrSearchEnded means the search ended before the condition being
+	// waited for was met
+	ErrSearchEnded = errors.New("search ended")
+
+	// ErrSearchInProgress means a search cannot be started because another
+	// has not yet ended with a bestmove
+	ErrSearchInProgress = errors.New("a search is already in progress")
+)
@@ -0,0 +1,74 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+
+	eng, _ := newOptionsTestEngine(t)
+
+	_, err := eng.WaitBestMove(timeout)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("WaitBestMove: expected ErrTimeout, got %v", err)
+	}
+
+	if err = eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = eng.WaitForDepth(5, timeout)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("WaitForDepth: expected ErrTimeout, got %v", err)
+	}
+
+	if err = eng.Go(GoParams{Depth: 1}); !errors.Is(err, ErrSearchInProgress) {
+		t.Errorf("Go: expected ErrSearchInProgress, got %v", err)
+	}
+
+	feedLines(t, eng, "bestmove e2e4")
+	_, err = eng.WaitForDepth(5, timeout)
+	if !errors.Is(err, ErrSearchEnded) {
+		t.Errorf("WaitForDepth: expected ErrSearchEnded, got %v", err)
+	}
+
+	err = eng.SetOptions([]EngOption{{Name: "Threads", Value: "0"}})
+	if !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("SetOptions: expected ErrOptionInvalid, got %v", err)
+	}
+
+	_, err = (&Engine{}).WaitBestMove(timeout)
+	if !errors.Is(err, ErrChannelNotReady) {
+		t.Errorf("WaitBestMove: expected ErrChannelNotReady, got %v", err)
+	}
+
+	mock := newMockEngine(t, "noreadyok")
+	if err = mock.WaitReadyOK(timeout); !errors.Is(err, ErrTimeout) {
+		t.Errorf("WaitReadyOK: expected ErrTimeout, got %v", err)
+	}
+
+	mock.Close()
+	if err = mock.SendCommand("isready"); !errors.Is(err, ErrEngineExited) {
+		t.Errorf("SendCommand: expected ErrEngineExited, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValidateFEN checks that a FEN string is well formed. It checks the six
+// fields, that every rank describes exactly eight squares using valid piece
+// letters, that each side has one king, the active color, the castling rights,
+// the en passant square, and the two move counters
+//
+// The position itself is not checked for legality
+func ValidateFEN(fen string) error {
+	return validateFEN(fen, false)
+}
+
+// ValidateFEN960 is like ValidateFEN but also accepts the Shredder-FEN and
+// X-FEN castling rights used for Chess960, where a castling right may be given
+// as the file of the rook (e.g. "HAha")
+func ValidateFEN960(fen string) error {
+	return validateFEN(fen, true)
+}
+
+// validates a fen, allowing rook files in the castling rights if chess960 is
+// set
+func validateFEN(fen string, chess960 bool) error {
+	fields := strings.Split(fen, " ")
+	if len(fields) != 6 {
+		return fmt.Errorf("fen must have 6 fields, has %d", len(fields))
+	}
+
+	// piece placement
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("fen board must have 8 ranks, has %d", len(ranks))
+	}
+
+	kings := map[rune]int{}
+	for i, rank := range ranks {
+		squares := 0
+		lastDigit := false
+
+		for _, c := range rank {
+			switch {
+			case c >= '1' && c <= '8':
+				if lastDigit {
+					return fmt.Errorf("fen rank %d has consecutive digits", 8-i)
+				}
+				squares += int(c - '0')
+				lastDigit = true
+			case strings.ContainsRune("pnbrqkPNBRQK", c):
+				if c == 'k' || c == 'K' {
+					kings[c]++
+				}
+				squares++
+				lastDigit = false
+			default:
+				return fmt.Errorf("fen rank %d has invalid character %q", 8-i, c)
+			}
+		}
+
+		if squares != 8 {
+			return fmt.Errorf("fen rank %d describes %d squares", 8-i, squares)
+		}
+	}
+
+	if kings['K'] != 1 || kings['k'] != 1 {
+		return fmt.Errorf("fen must have one king per side")
+	}
+
+	// active color
+	if fields[1] != "w" && fields[1] != "b" {
+		return fmt.Errorf("fen active color must be w or b, is %q", fields[1])
+	}
+
+	// castling rights
+	castling := fields[2]
+	switch {
+	case castling == "":
+		return fmt.Errorf("fen castling rights are empty")
+	case castling == "-":
+	case chess960:
+		// rights may also be given as rook files, but each side can have at
+		// most two and each right may only appear once
+		seen := map[rune]bool{}
+		white, black := 0, 0
+		for _, c := range castling {
+			switch {
+			case c == 'K' || c == 'Q' || (c >= 'A' && c <= 'H'):
+				white++
+			case c == 'k' || c == 'q' || (c >= 'a' && c <= 'h'):
+				black++
+			default:
+				return fmt.Errorf("invalid fen castling rights %q", castling)
+			}
+
+			if seen[c] {
+				return fmt.Errorf("invalid fen castling rights %q", castling)
+			}
+			seen[c] = true
+		}
+
+		if white > 2 || black > 2 {
+			return fmt.Errorf("invalid fen castling rights %q", castling)
+		}
+	default:
+		order := "KQkq"
+		last := -1
+		for _, c := range castling {
+			i := strings.IndexRune(order, c)
+			if i <= last {
+				return fmt.Errorf("invalid fen castling rights %q", castling)
+			}
+			last = i
+		}
+	}
+
+	// en passant target square, which is behind the pawn that just moved
+	if fields[3] != "-" {
+		sq, err := ParseSquare(fields[3])
+		if err != nil {
+			return fmt.Errorf("invalid fen en passant square: %v", err)
+		}
+
+		if (fields[1] == "w" && sq.Rank() != 5) ||
+			(fields[1] == "b" && sq.Rank() != 2) {
+			return fmt.Errorf("fen en passant square %s is not valid for %s to move",
+				fields[3], fields[1])
+		}
+	}
+
+	// move counters
+	halfmove, err := strconv.Atoi(fields[4])
+	if err != nil || halfmove < 0 {
+		return fmt.Errorf("invalid fen halfmove clock %q", fields[4])
+	}
+
+	fullmove, err := strconv.Atoi(fields[5])
+	if err != nil || fullmove < 1 {
+		return fmt.Errorf("invalid fen fullmove number %q", fields[5])
+	}
+
+	return nil
+}
+
+// SendFENChecked validates the FEN string and, if it is well formed, updates
+// the engine position with it. The FEN is checked with ValidateFEN960 if
+// Chess960 mode is enabled and ValidateFEN otherwise
+func (e *Engine) SendFENChecked(fen string) error {
+	e.RLock()
+	chess960 := e.chess960
+	e.RUnlock()
+
+	if err := validateFEN(fen, chess960); err != nil {
+		return err
+	}
+
+	return e.SendFEN(fen)
+}
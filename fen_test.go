@@ -0,0 +1,163 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateFEN(t *testing.T) {
+	tt := []struct {
+		name string
+		fen  string
+		err  bool
+	}{
+		{name: "start position", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{name: "after e4", fen: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"},
+		{name: "after e4 c5", fen: "rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2"},
+		{name: "no castling", fen: "4k3/8/8/8/8/8/8/4K3 w - - 0 1"},
+		{name: "partial castling", fen: "r3k3/8/8/8/8/8/8/4K2R w Kq - 12 40"},
+		{name: "kiwipete", fen: "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"},
+
+		{name: "empty", fen: "", err: true},
+		{name: "missing counters", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -", err: true},
+		{name: "extra field", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 x", err: true},
+		{name: "double space", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR  w KQkq - 0 1", err: true},
+		{name: "seven ranks", fen: "rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "short rank", fen: "rnbqkbnr/pppppppp/8/8/7/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "long rank", fen: "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "overfull rank", fen: "rnbqkbnrp/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "consecutive digits", fen: "rnbqkbnr/pppppppp/44/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "bad piece", fen: "rnbqkbnr/pppppppp/8/8/3X4/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "no black king", fen: "rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1", err: true},
+		{name: "two white kings", fen: "rnbqkbnr/pppppppp/8/8/4K3/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", err: true},
+		{name: "bad color", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1", err: true},
+		{name: "bad castling letter", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkx - 0 1", err: true},
+		{name: "castling out of order", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w kqKQ - 0 1", err: true},
+		{name: "castling repeated", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KK - 0 1", err: true},
+		{name: "empty castling", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w  - 0 1", err: true},
+		{name: "bad en passant", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq z9 0 1", err: true},
+		{name: "en passant wrong rank", fen: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e6 0 1", err: true},
+		{name: "negative halfmove", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1", err: true},
+		{name: "zero fullmove", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0", err: true},
+		{name: "non-numeric fullmove", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 one", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateFEN(tc.fen)
+			if tc.err && err == nil {
+				t.Fatalf("expected error for %q", tc.fen)
+			}
+			if !tc.err && err != nil {
+				t.Fatalf("unexpected error for %q: %v", tc.fen, err)
+			}
+		})
+	}
+}
+
+func TestSendFENChecked(t *testing.T) {
+	eng, buf := newTestEngine()
+
+	if err := eng.SendFENChecked("8/8/8/8/8/8/8/8 w - - 0 1"); err == nil {
+		t.Fatal("expected error for fen without kings")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("invalid fen should not be sent, got %q", buf.String())
+	}
+
+	fen := "4k3/8/8/8/8/8/8/4K3 w - - 0 1"
+	if err := eng.SendFENChecked(fen); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "position fen "+fen+"\n" {
+		t.Fatalf("unexpected command %q", buf.String())
+	}
+}
+
+func TestValidateFEN960(t *testing.T) {
+	valid := []string{
+		// standard rights are still accepted
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		// Shredder-FEN
+		"bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 0 1",
+		// X-FEN
+		"rk2r3/8/8/8/8/8/8/RK2R3 w KQkq - 0 1",
+		"nrkbbqrn/pppppppp/8/8/8/8/PPPPPPPP/NRKBBQRN w GBgb - 0 1",
+	}
+	for _, fen := range valid {
+		if err := ValidateFEN960(fen); err != nil {
+			t.Errorf("unexpected error for %q: %v", fen, err)
+		}
+	}
+
+	if err := ValidateFEN("bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 0 1"); err == nil {
+		t.Error("expected Shredder-FEN castling rights to be rejected outside chess960")
+	}
+
+	invalid := []string{
+		"bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEGe - 0 1",
+		"bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEKge - 0 1",
+		"bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w Gx - 0 1",
+	}
+	for _, fen := range invalid {
+		if err := ValidateFEN960(fen); err == nil {
+			t.Errorf("expected error for %q", fen)
+		}
+	}
+}
+
+func TestChess960(t *testing.T) {
+	eng, buf := newTestEngine()
+
+	fen := "bqnbrkrn/pppppppp/8/8/8/8/PPPPPPPP/BQNBRKRN w GEge - 0 1"
+	if err := eng.SendFENChecked(fen); err == nil {
+		t.Fatal("expected Shredder-FEN to be rejected before chess960 is enabled")
+	}
+
+	if err := eng.SetChess960(true); err != nil {
+		t.Fatal(err)
+	}
+	if !eng.Chess960() {
+		t.Fatal("expected chess960 to be enabled")
+	}
+	if buf.String() != "setoption name UCI_Chess960 value true\n" {
+		t.Fatalf("unexpected command %q", buf.String())
+	}
+
+	if err := eng.SendFENChecked(fen); err != nil {
+		t.Fatal(err)
+	}
+
+	// castling as king takes rook
+	feedLines(t, eng, "bestmove f1g1 ponder f8e8")
+	b, err := eng.WaitBestMove(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	best, ponder, err := b.Parsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.From.String() != "f1" || best.To.String() != "g1" ||
+		ponder.From.String() != "f8" || ponder.To.String() != "e8" {
+		t.Fatalf("unexpected castling moves %s %s", best, ponder)
+	}
+}
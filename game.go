@@ -0,0 +1,215 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Color is the side to move in a position
+type Color int
+
+const (
+	White Color = iota
+	Black
+)
+
+// String returns "white" or "black"
+func (c Color) String() string {
+	if c == Black {
+		return "black"
+	}
+	return "white"
+}
+
+// game is a position given as a starting position and the moves played from
+// it
+type game struct {
+	fen   string   // starting position, or empty for the standard start
+	moves []string // moves played from the starting position
+}
+
+// returns the position command describing the game
+func (g game) positionCommand() string {
+	cmd := "position startpos"
+	if g.fen != "" {
+		cmd = "position fen " + g.fen
+	}
+
+	if len(g.moves) > 0 {
+		cmd += " moves " + strings.Join(g.moves, " ")
+	}
+
+	return cmd
+}
+
+// returns the ply of the starting position, counted from the standard
+// starting position at ply 0, from the active color and fullmove number of
+// the fen. Fields that are missing or malformed count as white to move at
+// move 1
+func (g game) startPly() int {
+	fields := strings.Fields(g.fen)
+
+	ply := 0
+	if len(fields) > 5 {
+		if n, err := strconv.Atoi(fields[5]); err == nil && n > 1 {
+			ply = 2 * (n - 1)
+		}
+	}
+	if len(fields) > 1 && fields[1] == "b" {
+		ply++
+	}
+
+	return ply
+}
+
+// sends the position described by the game to the engine and, if successful,
+// tracks it as the current game
+func (e *Engine) setGame(g game) error {
+	if err := e.SendCommand(g.positionCommand()); err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.game = g
+
+	return nil
+}
+
+// PushMove appends a move in UCI long algebraic notation to the current game
+// and sends the resulting position to the engine. The game starts from the
+// position last set with SendStartPos or SendFEN, or from the standard
+// starting position if neither has been called
+func (e *Engine) PushMove(move string) error {
+	if _, err := ParseUCIMove(move); err != nil {
+		return err
+	}
+
+	e.RLock()
+	g := game{fen: e.game.fen}
+	g.moves = append(append(g.moves, e.game.moves...), move)
+	e.RUnlock()
+
+	return e.setGame(g)
+}
+
+// SendMoves appends several moves in UCI long algebraic notation to the
+// current game and sends the resulting position to the engine once, e.g. to
+// catch up with moves played elsewhere. If any move is malformed, nothing is
+// sent and the game is unchanged
+func (e *Engine) SendMoves(moves ...string) error {
+	for _, m := range moves {
+		if _, err := ParseUCIMove(m); err != nil {
+			return err
+		}
+	}
+
+	e.RLock()
+	g := game{fen: e.game.fen}
+	g.moves = append(append(g.moves, e.game.moves...), moves...)
+	e.RUnlock()
+
+	return e.setGame(g)
+}
+
+// Ply returns the number of half moves played in the current game, counting
+// those before its starting position as given by the fullmove number and
+// active color of the FEN. The standard starting position is ply 0
+func (e *Engine) Ply() int {
+	e.RLock()
+	defer e.RUnlock()
+
+	return e.game.startPly() + len(e.game.moves)
+}
+
+// SideToMove returns the side to move in the current game
+func (e *Engine) SideToMove() Color {
+	if e.Ply()%2 == 1 {
+		return Black
+	}
+	return White
+}
+
+// SANToUCI converts a line of moves in standard algebraic notation, as found
+// in PGN, to UCI long algebraic notation. The package has no move generator,
+// so converting SAN, which needs the legal moves of each position, is left to
+// an implementation of this interface, e.g. one backed by a chess library
+type SANToUCI interface {
+	// ToUCI converts moves played from the position fen, which is empty for
+	// the standard starting position
+	ToUCI(fen string, moves []string) ([]string, error)
+}
+
+// SANToUCIFunc adapts a function to the SANToUCI interface
+type SANToUCIFunc func(fen string, moves []string) ([]string, error)
+
+// ToUCI calls f(fen, moves)
+func (f SANToUCIFunc) ToUCI(fen string, moves []string) ([]string, error) {
+	return f(fen, moves)
+}
+
+// SetSANConverter sets the converter used by SendSANLine
+func (e *Engine) SetSANConverter(c SANToUCI) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.sanConverter = c
+}
+
+// SendSANLine converts moves in standard algebraic notation, played from
+// startFEN, with the converter set by SetSANConverter, and sends the resulting
+// position to the engine as the start of a new game, as SendFEN and SendMoves
+// would. An empty startFEN is the standard starting position
+//
+// Nothing is sent if there is no converter, the moves cannot be converted, or
+// the converter returns a malformed UCI move
+func (e *Engine) SendSANLine(startFEN string, sanMoves []string) error {
+	e.RLock()
+	c := e.sanConverter
+	e.RUnlock()
+
+	if c == nil {
+		return errors.New("no SAN converter set")
+	}
+
+	moves, err := c.ToUCI(startFEN, sanMoves)
+	if err != nil {
+		return fmt.Errorf("converting SAN moves: %w", err)
+	}
+	for _, m := range moves {
+		if _, err := ParseUCIMove(m); err != nil {
+			return fmt.Errorf("converting SAN moves: %w", err)
+		}
+	}
+
+	return e.setGame(game{fen: startFEN, moves: moves})
+}
+
+// ResetGame clears the moves of the current game and returns its start to
+// the standard starting position. Nothing is sent to the engine
+func (e *Engine) ResetGame() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.game = game{}
+}
@@ -0,0 +1,208 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPushMove(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	for _, m := range []string{"e2e4", "e7e5", "g1f3"} {
+		if err := eng.PushMove(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := eng.PushMove("Nc6"); err == nil {
+		t.Fatal("expected an invalid move to be rejected")
+	}
+
+	expected := []string{
+		"position startpos moves e2e4",
+		"position startpos moves e2e4 e7e5",
+		"position startpos moves e2e4 e7e5 g1f3",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q, got %q", expected, stdin.Lines())
+	}
+
+	// a new start position clears the moves
+	stdin.Reset()
+	fen := "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"
+	if err := eng.SendFEN(fen); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"e2e4", "e8d7"} {
+		if err := eng.PushMove(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eng.ResetGame()
+	if err := eng.PushMove("d2d4"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{
+		"position fen " + fen,
+		"position fen " + fen + " moves e2e4",
+		"position fen " + fen + " moves e2e4 e8d7",
+		"position startpos moves d2d4",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q, got %q", expected, stdin.Lines())
+	}
+}
+
+func TestSendMoves(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	if err := eng.SendMoves("e2e4", "e7e5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.PushMove("g1f3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SendMoves("b8c6", "f1b5", "a7a6"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a malformed move anywhere rejects the whole batch
+	if err := eng.SendMoves("b5a4", "Nf6"); err == nil {
+		t.Fatal("expected an invalid move to be rejected")
+	}
+	if err := eng.SendMoves("e1g1"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"position startpos moves e2e4 e7e5",
+		"position startpos moves e2e4 e7e5 g1f3",
+		"position startpos moves e2e4 e7e5 g1f3 b8c6 f1b5 a7a6",
+		"position startpos moves e2e4 e7e5 g1f3 b8c6 f1b5 a7a6 e1g1",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q, got %q", expected, stdin.Lines())
+	}
+}
+
+func TestPlyAndSideToMove(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	check := func(ply int, side Color) {
+		t.Helper()
+		if p := eng.Ply(); p != ply {
+			t.Errorf("expected ply %d, got %d", ply, p)
+		}
+		if s := eng.SideToMove(); s != side {
+			t.Errorf("expected %v to move, got %v", side, s)
+		}
+	}
+
+	// nothing sent yet is the standard starting position
+	check(0, White)
+
+	if err := eng.SendStartPos(); err != nil {
+		t.Fatal(err)
+	}
+	check(0, White)
+	if err := eng.SendMoves("e2e4", "e7e5", "g1f3"); err != nil {
+		t.Fatal(err)
+	}
+	check(3, Black)
+
+	// black to move at move 1 after 1. e4
+	if err := eng.SendFEN("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"); err != nil {
+		t.Fatal(err)
+	}
+	check(1, Black)
+	if err := eng.PushMove("c7c5"); err != nil {
+		t.Fatal(err)
+	}
+	check(2, White)
+
+	// black to move at move 40
+	if err := eng.SendFEN("8/8/4k3/8/8/4K3/8/8 b - - 12 40"); err != nil {
+		t.Fatal(err)
+	}
+	check(79, Black)
+
+	eng.ResetGame()
+	check(0, White)
+}
+
+func TestSendSANLine(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	if err := eng.SendSANLine("", []string{"e4"}); err == nil {
+		t.Fatal("expected an error without a converter")
+	}
+
+	// a stub that knows a single opening
+	table := map[string]string{"e4": "e2e4", "e5": "e7e5", "Nf3": "g1f3", "Nc6": "b8c6", "Bb5": "f1b5"}
+	var gotFEN string
+	eng.SetSANConverter(SANToUCIFunc(func(fen string, moves []string) ([]string, error) {
+		gotFEN = fen
+		var ret []string
+		for _, m := range moves {
+			u, ok := table[m]
+			if !ok {
+				return nil, fmt.Errorf("illegal move %s", m)
+			}
+			ret = append(ret, u)
+		}
+		return ret, nil
+	}))
+
+	if err := eng.SendSANLine("", []string{"e4", "e5", "Nf3", "Nc6", "Bb5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.PushMove("a7a6"); err != nil {
+		t.Fatal(err)
+	}
+
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	if err := eng.SendSANLine(fen, []string{"e5"}); err != nil {
+		t.Fatal(err)
+	}
+	if gotFEN != fen {
+		t.Errorf("expected the converter to get the start position, got %q", gotFEN)
+	}
+
+	// neither a move the converter rejects nor a malformed conversion is sent
+	if err := eng.SendSANLine("", []string{"e4", "Ke2"}); err == nil {
+		t.Error("expected an unconvertible move to be rejected")
+	}
+	table["O-O"] = "O-O"
+	if err := eng.SendSANLine("", []string{"O-O"}); err == nil {
+		t.Error("expected a malformed conversion to be rejected")
+	}
+
+	expected := []string{
+		"position startpos moves e2e4 e7e5 g1f3 b8c6 f1b5",
+		"position startpos moves e2e4 e7e5 g1f3 b8c6 f1b5 a7a6",
+		"position fen " + fen + " moves e7e5",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q, got %q", expected, stdin.Lines())
+	}
+}
@@ -0,0 +1,137 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// a game reaching this many plies is stopped unfinished
+	matchMaxPlies = 600
+
+	// how long PlayMatch waits for an engine to choose a move
+	matchMoveTimeout = 5 * time.Minute
+)
+
+// MatchResult is the outcome of a game played by PlayMatch
+type MatchResult struct {
+	Moves  []string // the moves of the game from the starting position, including the opening
+	Result string   // "1-0", "0-1", "1/2-1/2", or "*" if the game was not finished
+	Reason string   // how the game ended, e.g. "checkmate"
+}
+
+// returns the last info line with a score, or false if there is none
+func lastScore(info []Info) (Info, bool) {
+	for i := len(info) - 1; i >= 0; i-- {
+		if info[i].hasScore {
+			return info[i], true
+		}
+	}
+
+	return Info{}, false
+}
+
+// PlayMatch plays a game between two engines from the standard starting
+// position, after the moves of the opening. The engines take turns searching
+// the game so far with the parameters p and the bestmove is played
+//
+// The game ends when the engine to move has no move (bestmove "(none)" or
+// "0000"). It is scored as checkmate if that engine reports a mate score of
+// 0, or its opponent reported mate in 1 with its last move, and as stalemate
+// otherwise. Moves are not checked for legality, as the package has no move
+// generator, but an engine sending a move that is not well formed loses the
+// game. Games are stopped unfinished after 600 plies
+//
+// p must describe a search that ends on its own, so it cannot be infinite or
+// pondering. Each engine has 5 minutes to choose a move
+func PlayMatch(white, black *Engine, opening []string, p GoParams) (MatchResult, error) {
+	if err := p.Validate(); err != nil {
+		return MatchResult{}, err
+	}
+	if p.Infinite || p.Ponder {
+		return MatchResult{}, errors.New("match searches must end on their own")
+	}
+
+	for _, m := range opening {
+		if _, err := ParseUCIMove(m); err != nil {
+			return MatchResult{}, fmt.Errorf("opening: %w", err)
+		}
+	}
+
+	for _, e := range []*Engine{white, black} {
+		if err := e.SendUCINewGame(); err != nil {
+			return MatchResult{}, err
+		}
+		if err := e.WaitReadyOK(defaultReadyTimeout); err != nil {
+			return MatchResult{}, err
+		}
+	}
+
+	res := MatchResult{Moves: append([]string(nil), opening...)}
+	var prev Info // the last scored info line of the previous move
+
+	for len(res.Moves) < matchMaxPlies {
+		mover, side, loss := white, "white", "0-1"
+		if len(res.Moves)%2 == 1 {
+			mover, side, loss = black, "black", "1-0"
+		}
+
+		if err := mover.setGame(game{moves: append([]string(nil), res.Moves...)}); err != nil {
+			return res, err
+		}
+
+		h, err := mover.StartSearch(p)
+		if err != nil {
+			return res, err
+		}
+
+		b, err := h.Wait(matchMoveTimeout)
+		if err != nil {
+			return res, fmt.Errorf("waiting for %s to move: %w", side, err)
+		}
+
+		last, _ := lastScore(mover.GetInfo(-1))
+
+		switch b.BestMove {
+		case "", noMove, nullMove:
+			mated := last.Score.Mate && last.Score.Val <= 0
+			mating := prev.Score.Mate && prev.Score.Val == 1
+			if mated || mating {
+				res.Result, res.Reason = loss, "checkmate"
+			} else {
+				res.Result, res.Reason = "1/2-1/2", "stalemate"
+			}
+			return res, nil
+		}
+
+		if _, err := ParseUCIMove(b.BestMove); err != nil {
+			res.Result, res.Reason = loss, fmt.Sprintf("%s sent the illegal move %q", side, b.BestMove)
+			return res, nil
+		}
+
+		res.Moves = append(res.Moves, b.BestMove)
+		prev = last
+	}
+
+	res.Result, res.Reason = "*", "move limit reached"
+
+	return res, nil
+}
@@ -0,0 +1,83 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlayMatch(t *testing.T) {
+	// fool's mate
+	white := newMockEngine(t,
+		"move:startpos=f2f3",
+		"move:startpos moves f2f3 e7e5=g2g4",
+		"move:startpos moves f2f3 e7e5 g2g4 d8h4=(none);mate 0")
+	black := newMockEngine(t,
+		"move:startpos moves f2f3=e7e5",
+		"move:startpos moves f2f3 e7e5 g2g4=d8h4;mate 1")
+
+	res, err := PlayMatch(white, black, nil, GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moves := []string{"f2f3", "e7e5", "g2g4", "d8h4"}
+	if !reflect.DeepEqual(res.Moves, moves) {
+		t.Errorf("expected moves %v, got %v", moves, res.Moves)
+	}
+	if res.Result != "0-1" || res.Reason != "checkmate" {
+		t.Errorf("expected 0-1 by checkmate, got %s by %s", res.Result, res.Reason)
+	}
+
+	// the same game from an opening, with white stalemated instead
+	white = newMockEngine(t, "move:startpos moves f2f3 e7e5=(none)")
+	black = newMockEngine(t)
+
+	res, err = PlayMatch(white, black, []string{"f2f3", "e7e5"}, GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Result != "1/2-1/2" || res.Reason != "stalemate" {
+		t.Errorf("expected 1/2-1/2 by stalemate, got %s by %s", res.Result, res.Reason)
+	}
+}
+
+func TestPlayMatchIllegalMove(t *testing.T) {
+	white := newMockEngine(t)
+	black := newMockEngine(t, "move:startpos moves e2e4=e7e9")
+
+	res, err := PlayMatch(white, black, nil, GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Result != "1-0" {
+		t.Errorf("expected black to forfeit, got %s by %s", res.Result, res.Reason)
+	}
+	if !reflect.DeepEqual(res.Moves, []string{"e2e4"}) {
+		t.Errorf("expected the illegal move to be left out, got %v", res.Moves)
+	}
+
+	if _, err := PlayMatch(white, black, []string{"e2e4", "xx"}, GoParams{Depth: 2}); err == nil {
+		t.Error("expected an error for a malformed opening")
+	}
+	if _, err := PlayMatch(white, black, nil, GoParams{Infinite: true}); err == nil {
+		t.Error("expected an error for an infinite search")
+	}
+}
@@ -0,0 +1,338 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// when set in the environment, the test binary runs as a mock engine instead
+// of running the tests
+const mockEngineEnv = "UCI_MOCK_ENGINE"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mockEngineEnv) != "" {
+		runMockEngine(os.Args[1:])
+		os.Exit(0)
+	}
+
+	// engines started by the tests inherit the environment. When built with
+	// the race detector, don't let them linger for a second on exit
+	os.Setenv(mockEngineEnv, "1")
+	os.Setenv("GORACE", strings.TrimSpace(os.Getenv("GORACE")+" atexit_sleep_ms=0"))
+	os.Exit(m.Run())
+}
+
+// options advertised by the mock engine in response to uci
+var mockOptions = []string{
+	"option name Hash type spin default 16 min 1 max 33554432",
+	"option name Threads type spin default 1 min 1 max 512",
+	"option name MultiPV type spin default 1 min 1 max 500",
+	"option name Ponder type check default false",
+	"option name Clear Hash type button",
+	"option name Style type combo default Normal var Solid var Normal var Risky",
+}
+
+// runMockEngine is a minimal scripted UCI engine, run in a child process of
+// the test binary. Searches emit a few info lines followed by the bestmove
+// e2e4, or the first of the searchmoves if given, unless the search is
+// infinite in which case the bestmove is withheld until stop, or pondering in
+// which case it is withheld until ponderhit or stop
+//
+// The behavior can be changed with arguments:
+//
+//	noreadyok       never answer isready
+//	noquit          ignore quit
+//	pidfile:<path>  write the process id to path on startup
+//	grandchild:<path>
+//	                start a process sharing the engine's stdout, which sleeps
+//	                for a minute, and write its process id to path
+//	ack             acknowledge setoption with "info string <name> set to <value>"
+//	echo            echo every command received before answering it
+//	partial:<line>  answer go with the info lines, then write line without a
+//	                newline and exit
+//	move:<fen>=<m>  play the move m when searching the position fen, which
+//	                may also be "startpos" followed by moves. The move may be
+//	                followed by ";<score>", e.g. "d8h4;mate 1", to report that
+//	                score instead of cp
+//
+// bench runs a two position benchmark, writing its summary to stderr as
+// Stockfish does
+func runMockEngine(args []string) {
+	flags := map[string]bool{}
+	partial := ""
+	moves := map[string]string{}
+	scores := map[string]string{}
+	for _, a := range args {
+		if mapping, ok := strings.CutPrefix(a, "move:"); ok {
+			fen, move, _ := strings.Cut(mapping, "=")
+			move, score, _ := strings.Cut(move, ";")
+			moves[fen] = move
+			scores[fen] = score
+			continue
+		}
+		if path, ok := strings.CutPrefix(a, "pidfile:"); ok {
+			os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0644)
+			continue
+		}
+		if path, ok := strings.CutPrefix(a, "grandchild:"); ok {
+			cmd := exec.Command(os.Args[0], "sleep")
+			cmd.Stdout = os.Stdout
+			if err := cmd.Start(); err == nil {
+				os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0644)
+			}
+			continue
+		}
+		if line, ok := strings.CutPrefix(a, "partial:"); ok {
+			partial = line
+			continue
+		}
+		flags[a] = true
+	}
+
+	// run as the grandchild started by another mock engine
+	if flags["sleep"] {
+		time.Sleep(time.Minute)
+		return
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	send := func(lines ...string) {
+		for _, l := range lines {
+			fmt.Fprintln(out, l)
+		}
+		out.Flush()
+	}
+
+	position := ""
+	searching := false
+	infinite := false
+	bestmove := ""
+
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		fields := strings.Fields(in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if flags["echo"] {
+			send(in.Text())
+		}
+
+		switch fields[0] {
+		case "uci":
+			send("id name Mock Engine", "id author The uci authors")
+			send(mockOptions...)
+			send("uciok")
+		case "isready":
+			if !flags["noreadyok"] {
+				send("readyok")
+			}
+		case "position":
+			position = strings.Join(fields[1:], " ")
+		case "go":
+			// restricted searches play the first of the searchmoves
+			bestmove = "bestmove e2e4 ponder e7e5"
+			pv := "e2e4 e7e5"
+			score1, score2 := "cp 10", "cp 15"
+			key := strings.TrimPrefix(position, "fen ")
+			if move, ok := moves[key]; ok {
+				bestmove = "bestmove " + move
+				pv = move
+				if s := scores[key]; s != "" {
+					score1, score2 = s, s
+				}
+			}
+			for i, f := range fields {
+				if f == "searchmoves" && i+1 < len(fields) {
+					bestmove = "bestmove " + fields[i+1]
+					pv = fields[i+1]
+				}
+			}
+
+			if pv == noMove {
+				// no legal moves, so there is nothing to search
+				send("info depth 0 score " + score2)
+			} else {
+				send("info depth 1 score "+score1+" nodes 20 time 1 pv "+strings.Fields(pv)[0],
+					"info depth 2 score "+score2+" nodes 80 time 2 pv "+pv)
+			}
+
+			if partial != "" {
+				fmt.Fprint(out, partial)
+				out.Flush()
+				os.Exit(1)
+			}
+
+			infinite = fields[len(fields)-1] == "infinite"
+			pondering := len(fields) > 1 && fields[1] == "ponder"
+			if infinite || pondering {
+				searching = true
+			} else {
+				send(bestmove)
+			}
+		case "setoption":
+			// setoption name <id> [value <x>]
+			line := strings.Join(fields, " ")
+			name, value, _ := strings.Cut(strings.TrimPrefix(line, "setoption name "), " value ")
+			if flags["ack"] {
+				send("info string " + name + " set to " + value)
+			}
+		case "ponderhit":
+			// the search carries on as a normal search
+			if searching && !infinite {
+				searching = false
+				send(bestmove)
+			}
+		case "stop":
+			if searching {
+				searching = false
+				send(bestmove)
+			}
+		case "bench":
+			// like Stockfish, the searches go to stdout and the summary to
+			// stderr
+			send("Position: 1/2 (startpos)",
+				"info depth 1 score cp 18 nodes 20 time 1 pv e2e4",
+				"bestmove e2e4",
+				"",
+				"Position: 2/2 (startpos moves e2e4)",
+				"info depth 1 score cp -10 nodes 22 time 1 pv c7c5",
+				"bestmove c7c5")
+			fmt.Fprint(os.Stderr, "\n===========================\n"+
+				"Total time (ms) : 2\nNodes searched  : 42\nNodes/second    : 21000\n")
+		case "quit":
+			if !flags["noquit"] {
+				return
+			}
+		}
+	}
+}
+
+// newMockEngine starts a mock engine process with the given arguments. The
+// engine is shut down when the test finishes
+func newMockEngine(t *testing.T, args ...string) *Engine {
+	t.Helper()
+
+	eng, err := NewEngineFromPath(os.Args[0], "", 0, 0, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	return eng
+}
+
+// testStdin stands in for the stdin of an engine process. It records every
+// command written to it, and answers isready with readyok on the engine's
+// stdout channel
+type testStdin struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	stdout chan<- string
+}
+
+func (s *testStdin) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Write(p)
+	for _, l := range strings.Split(string(p), "\n") {
+		if l == "isready" {
+			s.stdout <- "readyok"
+		}
+	}
+
+	return len(p), nil
+}
+
+// String returns everything written so far
+func (s *testStdin) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buf.String()
+}
+
+// Len returns the number of bytes written so far
+func (s *testStdin) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buf.Len()
+}
+
+// Reset forgets everything written so far
+func (s *testStdin) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+}
+
+// Lines returns the commands written so far
+func (s *testStdin) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return strings.Split(strings.TrimSuffix(s.buf.String(), "\n"), "\n")
+}
+
+// newTestEngine returns an Engine that is not backed by a process. Commands
+// sent to the engine are written to the returned testStdin, and engine output
+// is fed to the parser directly with feedLines
+func newTestEngine() (*Engine, *testStdin) {
+	stdout := make(chan string, defaultStdoutChanSize)
+	stdin := &testStdin{stdout: stdout}
+
+	eng := &Engine{}
+	eng.stdin = bufio.NewWriter(stdin)
+	eng.stdout = stdout
+	eng.startStdoutParsing()
+
+	return eng, stdin
+}
+
+// feedLines runs each line through the engine output parser
+func feedLines(t *testing.T, e *Engine, lines ...string) {
+	t.Helper()
+
+	for _, l := range lines {
+		if err := e.parseStdout(l); err != nil {
+			t.Fatalf("parsing %q: %v", l, err)
+		}
+	}
+}
+
+// sendLines queues lines on the engine's stdout channel to be parsed by the
+// engine's parsing goroutine
+func sendLines(e *Engine, lines ...string) {
+	for _, l := range lines {
+		e.stdout <- l
+	}
+}
@@ -0,0 +1,165 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"fmt"
+)
+
+const (
+	// the null move as sent by engines and GUIs
+	nullMove = "0000"
+
+	// sent by engines as the bestmove when there are no legal moves
+	noMove = "(none)"
+)
+
+// Square is a square on the board, numbered from 0 (a1) to 63 (h8)
+type Square uint8
+
+// ParseSquare parses a square in algebraic notation such as "e4"
+func ParseSquare(s string) (Square, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 0, fmt.Errorf("invalid square %q", s)
+	}
+
+	return Square((s[1]-'1')*8 + (s[0] - 'a')), nil
+}
+
+// File returns the file of the square, 0 for the a-file through 7 for the
+// h-file
+func (s Square) File() int {
+	return int(s) % 8
+}
+
+// Rank returns the rank of the square, 0 for the first rank through 7 for the
+// eighth rank
+func (s Square) Rank() int {
+	return int(s) / 8
+}
+
+// String returns the square in algebraic notation
+func (s Square) String() string {
+	return string([]byte{byte('a' + s.File()), byte('1' + s.Rank())})
+}
+
+// Move is a move in UCI long algebraic notation. The zero value is the null
+// move
+//
+// Only the structure of the move is checked when parsing; there is no board,
+// so a parsed move is not necessarily legal
+type Move struct {
+	From      Square
+	To        Square
+	Promotion byte // promotion piece (q, r, b or n), 0 if not a promotion
+}
+
+// ParseUCIMove parses a move in UCI long algebraic notation such as "e2e4" or
+// "e7e8q". Castling is encoded as the king move (e.g. "e1g1") and "0000" is
+// the null move
+//
+// In Chess960 mode castling is encoded as the king capturing its own rook
+// (e.g. "e1h1" or "b8a8"). Without a board these are ordinary moves, so they
+// are accepted whether or not Chess960 mode is enabled
+func ParseUCIMove(s string) (Move, error) {
+	if s == nullMove {
+		return Move{}, nil
+	}
+
+	if len(s) != 4 && len(s) != 5 {
+		return Move{}, fmt.Errorf("invalid move %q", s)
+	}
+
+	from, err := ParseSquare(s[0:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %q: %v", s, err)
+	}
+
+	to, err := ParseSquare(s[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("invalid move %q: %v", s, err)
+	}
+
+	if from == to {
+		return Move{}, fmt.Errorf("invalid move %q: from and to squares are the same", s)
+	}
+
+	m := Move{From: from, To: to}
+
+	if len(s) == 5 {
+		switch s[4] {
+		case 'q', 'r', 'b', 'n':
+		default:
+			return Move{}, fmt.Errorf("invalid move %q: bad promotion piece", s)
+		}
+
+		// a pawn promotes by moving from the seventh rank to the eighth, or
+		// from the second rank to the first, straight or diagonally
+		white := from.Rank() == 6 && to.Rank() == 7
+		black := from.Rank() == 1 && to.Rank() == 0
+		df := from.File() - to.File()
+		if !(white || black) || df < -1 || df > 1 {
+			return Move{}, fmt.Errorf("invalid move %q: promotion from %s to %s", s, from, to)
+		}
+
+		m.Promotion = s[4]
+	}
+
+	return m, nil
+}
+
+// IsNull returns true if the move is the null move
+func (m Move) IsNull() bool {
+	return m == Move{}
+}
+
+// String returns the move in UCI long algebraic notation
+func (m Move) String() string {
+	if m.IsNull() {
+		return nullMove
+	}
+
+	s := m.From.String() + m.To.String()
+	if m.Promotion != 0 {
+		s += string(m.Promotion)
+	}
+
+	return s
+}
+
+// Parsed returns the bestmove and ponder move as Moves. A missing ponder move,
+// or a bestmove of "(none)" when there are no legal moves, is returned as the
+// null move
+func (b BestMove) Parsed() (best, ponder Move, err error) {
+	parse := func(s string) (Move, error) {
+		if s == "" || s == noMove {
+			return Move{}, nil
+		}
+		return ParseUCIMove(s)
+	}
+
+	if best, err = parse(b.BestMove); err != nil {
+		return Move{}, Move{}, err
+	}
+
+	if ponder, err = parse(b.Ponder); err != nil {
+		return Move{}, Move{}, err
+	}
+
+	return best, ponder, nil
+}
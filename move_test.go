@@ -0,0 +1,95 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"testing"
+)
+
+func TestParseUCIMove(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+		move  Move
+		err   bool
+	}{
+		{name: "pawn push", input: "e2e4", move: Move{From: 12, To: 28}},
+		{name: "knight", input: "g8f6", move: Move{From: 62, To: 45}},
+		{name: "white promotion", input: "e7e8q", move: Move{From: 52, To: 60, Promotion: 'q'}},
+		{name: "black capture promotion", input: "b2a1n", move: Move{From: 9, To: 0, Promotion: 'n'}},
+		{name: "white castles kingside", input: "e1g1", move: Move{From: 4, To: 6}},
+		{name: "black castles queenside", input: "e8c8", move: Move{From: 60, To: 58}},
+		{name: "null move", input: "0000", move: Move{}},
+		{name: "empty", input: "", err: true},
+		{name: "too short", input: "e2e", err: true},
+		{name: "too long", input: "e7e8qq", err: true},
+		{name: "off board", input: "e2e9", err: true},
+		{name: "bad file", input: "i2i4", err: true},
+		{name: "uppercase", input: "E2E4", err: true},
+		{name: "same square", input: "e2e2", err: true},
+		{name: "king promotion", input: "e7e8k", err: true},
+		{name: "promotion from wrong rank", input: "e6e7q", err: true},
+		{name: "promotion too wide", input: "a7c8q", err: true},
+		{name: "san", input: "Nf3", err: true},
+		{name: "none", input: "(none)", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseUCIMove(tc.input)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error parsing %q, got %+v", tc.input, m)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m != tc.move {
+				t.Fatalf("expected %+v, got %+v", tc.move, m)
+			}
+			if m.String() != tc.input {
+				t.Fatalf("expected String() %q, got %q", tc.input, m.String())
+			}
+		})
+	}
+}
+
+func TestBestMoveParsed(t *testing.T) {
+	best, ponder, err := BestMove{BestMove: "e2e4", Ponder: "e7e5"}.Parsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.String() != "e2e4" || ponder.String() != "e7e5" {
+		t.Fatalf("unexpected moves %s %s", best, ponder)
+	}
+
+	best, ponder, err = BestMove{BestMove: "(none)"}.Parsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !best.IsNull() || !ponder.IsNull() {
+		t.Fatalf("expected null moves, got %s %s", best, ponder)
+	}
+
+	if _, _, err = (BestMove{BestMove: "e2e4", Ponder: "garbage"}).Parsed(); err == nil {
+		t.Fatal("expected error for invalid ponder move")
+	}
+}
@@ -0,0 +1,597 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the types an option can have
+var optionTypes = map[string]bool{
+	"check": true, "spin": true, "combo": true, "button": true, "string": true,
+}
+
+// ParseOption parses an option line an engine sends in reply to the uci
+// command, such as
+//
+//	option name Clear Hash type button
+//	option name Style type combo default Normal var Solid var Normal var Risky
+//
+// and returns the option it describes. A value of "<empty>" is parsed as the
+// empty string. An error is returned if the line is not an option line or has
+// no name or type
+//
+// The line is parsed by its structure rather than by looking for keywords
+// anywhere, so names and values may contain words such as "default" or
+// "max": the name runs up to the "type" followed by one of the option types,
+// a string default runs to the end of the line, and each combo value runs up
+// to the next "var"
+func ParseOption(line string) (EngOption, error) {
+	s := uciFields(line)
+	if len(s) == 0 || s[0] != "option" {
+		return EngOption{}, fmt.Errorf("not an option line: %q", line)
+	}
+	if len(s) < 2 || s[1] != "name" {
+		return EngOption{}, fmt.Errorf("option has no name: %q", line)
+	}
+	s = s[2:]
+
+	// joins the words of a value
+	join := func(s []string) string {
+		ret := strings.Join(s, " ")
+		if ret == "<empty>" {
+			ret = ""
+		}
+		return ret
+	}
+
+	// the name ends at the first "type" followed by a known type, or failing
+	// that at the first "type"
+	t := -1
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == "type" && optionTypes[s[i+1]] {
+			t = i
+			break
+		}
+	}
+	if t == -1 {
+		t = slices.Index(s, "type")
+	}
+	if t == -1 || t+1 >= len(s) {
+		return EngOption{}, fmt.Errorf("option %q has no type", join(s))
+	}
+
+	o := EngOption{Name: join(s[:t]), Type: s[t+1]}
+	if o.Name == "" {
+		return EngOption{}, fmt.Errorf("option has no name: %q", line)
+	}
+	o.Internal = strings.HasPrefix(o.Name, "UCI_")
+
+	rest := s[t+2:]
+
+	switch o.Type {
+	case "button":
+	case "string":
+		// the default is free text, which may contain any word
+		if len(rest) > 0 && rest[0] == "default" {
+			o.Default = join(rest[1:])
+		}
+	case "combo":
+		// the default comes first, and each value runs up to the next var
+		i := 0
+		if len(rest) > 0 && rest[0] == "default" {
+			i = 1
+			for i < len(rest) && rest[i] != "var" {
+				i++
+			}
+			o.Default = join(rest[1:i])
+		}
+		for i < len(rest) {
+			j := i + 1
+			for j < len(rest) && rest[j] != "var" {
+				j++
+			}
+
+			// a var without any words, e.g. a trailing one, is no value
+			if j > i+1 {
+				o.Var = append(o.Var, join(rest[i+1:j]))
+			}
+			i = j
+		}
+	default:
+		// check and spin values are single words, as are those of unknown
+		// types
+		for i := 0; i+1 < len(rest); i++ {
+			switch rest[i] {
+			case "default":
+				o.Default = join(rest[i+1 : i+2])
+			case "min":
+				o.Min = rest[i+1]
+			case "max":
+				o.Max = rest[i+1]
+			case "var":
+				o.Var = append(o.Var, join(rest[i+1:i+2]))
+			default:
+				continue
+			}
+			i++
+		}
+	}
+
+	return o, nil
+}
+
+const (
+	// how long to wait for readyok after configuring the engine
+	defaultReadyTimeout = 5 * time.Second
+)
+
+// returns the option with the given name advertised by the engine. Option
+// names are not case sensitive. The caller must hold the engine lock
+func (e *Engine) findDefaultOption(name string) (EngOption, bool) {
+	for _, o := range e.defaultOptions {
+		if strings.EqualFold(o.Name, name) {
+			return o, true
+		}
+	}
+
+	return EngOption{}, false
+}
+
+// checks that an option has a name and, if the engine has advertised its
+// options, that the option exists and the value suits its type. The caller
+// must hold the engine lock
+func (e *Engine) validateOption(o EngOption) error {
+	if o.Name == "" {
+		return fmt.Errorf("%w: option has no name", ErrOptionInvalid)
+	}
+
+	if len(e.defaultOptions) == 0 {
+		return nil
+	}
+
+	def, ok := e.findDefaultOption(o.Name)
+	if !ok {
+		return fmt.Errorf("%w: option %q not supported by the engine", ErrOptionInvalid, o.Name)
+	}
+
+	switch def.Type {
+	case "button":
+		if o.Value != "" {
+			return fmt.Errorf("%w: button option %q does not take a value", ErrOptionInvalid, o.Name)
+		}
+	case "check":
+		if o.Value != "true" && o.Value != "false" {
+			return fmt.Errorf("%w: check option %q must be true or false, is %q",
+				ErrOptionInvalid, o.Name, o.Value)
+		}
+	case "spin":
+		v, err := strconv.Atoi(o.Value)
+		if err != nil {
+			return fmt.Errorf("%w: spin option %q must be an integer, is %q",
+				ErrOptionInvalid, o.Name, o.Value)
+		}
+
+		if lo, err := strconv.Atoi(def.Min); err == nil && v < lo {
+			return fmt.Errorf("%w: spin option %q value %d is below the minimum %d",
+				ErrOptionInvalid, o.Name, v, lo)
+		}
+		if hi, err := strconv.Atoi(def.Max); err == nil && v > hi {
+			return fmt.Errorf("%w: spin option %q value %d is above the maximum %d",
+				ErrOptionInvalid, o.Name, v, hi)
+		}
+	case "combo":
+		for _, v := range def.Var {
+			if strings.EqualFold(v, o.Value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: combo option %q has no value %q", ErrOptionInvalid, o.Name, o.Value)
+	}
+
+	return nil
+}
+
+// SetOptions validates and sends each option to the engine, then waits for
+// the engine to process them with a single isready round-trip
+//
+// If the engine has advertised its options (UCI has been called), each option
+// must be one of them and its value must suit the option's type. All options
+// are checked before any are sent, so nothing is sent if any option is invalid
+func (e *Engine) SetOptions(opts []EngOption) error {
+	e.RLock()
+	for _, o := range opts {
+		if err := e.validateOption(o); err != nil {
+			e.RUnlock()
+			return err
+		}
+	}
+	e.RUnlock()
+
+	for _, o := range opts {
+		if err := e.SendOption(o.Name, o.Value); err != nil {
+			return err
+		}
+	}
+
+	return e.WaitReadyOK(defaultReadyTimeout)
+}
+
+// returns the option with the given name and value, named as advertised by
+// the engine, checking that the engine advertises it with type typ and that
+// the value suits it
+func (e *Engine) advertisedOption(name, typ, value string) (EngOption, error) {
+	e.RLock()
+	defer e.RUnlock()
+
+	def, ok := e.findDefaultOption(name)
+	if !ok {
+		return EngOption{}, fmt.Errorf("%w: option %q not supported by the engine", ErrOptionInvalid, name)
+	}
+	if def.Type != typ {
+		return EngOption{}, fmt.Errorf("%w: option %q is a %s option, not %s",
+			ErrOptionInvalid, def.Name, def.Type, typ)
+	}
+
+	o := EngOption{Name: def.Name, Value: value}
+	if err := e.validateOption(o); err != nil {
+		return EngOption{}, err
+	}
+
+	return o, nil
+}
+
+// sends a value for a spin option the engine must advertise, checking it
+// against the option's min and max first
+func (e *Engine) setSpinOption(name string, value int) error {
+	o, err := e.advertisedOption(name, "spin", strconv.Itoa(value))
+	if err != nil {
+		return err
+	}
+
+	return e.SendOption(o.Name, o.Value)
+}
+
+// SetThreads sets the number of search threads with the engine's Threads
+// option. An error is returned if the engine does not advertise the option
+// (or UCI has not been called) or n is outside its range
+func (e *Engine) SetThreads(n int) error {
+	return e.setSpinOption("Threads", n)
+}
+
+// SetHashMB sets the size of the engine's hash table in MB with its Hash
+// option. An error is returned if the engine does not advertise the option
+// (or UCI has not been called) or mb is outside its range
+func (e *Engine) SetHashMB(mb int) error {
+	return e.setSpinOption("Hash", mb)
+}
+
+// AddPreset stores a named set of options, such as "analysis" or "blitz",
+// to be sent together with ApplyPreset. An existing preset with the same name
+// is replaced. Presets can also be given in the engine config file:
+//
+//	"presets": {
+//		"analysis": [{"name": "Threads", "value": "8"}, {"name": "MultiPV", "value": "3"}],
+//		"blitz": [{"name": "Threads", "value": "1"}, {"name": "MultiPV", "value": "1"}]
+//	}
+func (e *Engine) AddPreset(name string, opts []EngOption) {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.presets == nil {
+		e.presets = map[string][]EngOption{}
+	}
+	e.presets[name] = append([]EngOption(nil), opts...)
+}
+
+// ApplyPreset sends every option of the named preset with SetOptions, so the
+// options are validated first and the engine is waited for afterwards
+func (e *Engine) ApplyPreset(name string) error {
+	e.RLock()
+	opts, ok := e.presets[name]
+	e.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("no preset named %q", name)
+	}
+
+	return e.SetOptions(opts)
+}
+
+// SetBatchOptions turns batch mode on or off. In batch mode SendOption (and
+// the helpers built on it) writes setoption commands to the engine's input
+// buffer without flushing them, so configuring many options costs a single
+// write. The options reach the engine with CommitOptions, or with the next
+// other command, such as the isready sent by WaitReadyOK. Turning batch mode
+// off commits any options held back. Options that overflow the stdin buffer
+// are written early; see EngineOptions.StdinBufSize
+func (e *Engine) SetBatchOptions(batch bool) error {
+	e.stdinMu.Lock()
+	e.batchOptions = batch
+	e.stdinMu.Unlock()
+
+	if !batch {
+		return e.CommitOptions()
+	}
+
+	return nil
+}
+
+// CommitOptions flushes the options held back in batch mode to the engine
+func (e *Engine) CommitOptions() error {
+	e.stdinMu.Lock()
+	defer e.stdinMu.Unlock()
+
+	if err := e.stdin.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrEngineExited, err)
+	}
+
+	return nil
+}
+
+// PressButton sends a button option, such as "Clear Hash", which takes no
+// value. An error is returned if the engine does not advertise the option (or
+// UCI has not been called) or it is not a button
+func (e *Engine) PressButton(name string) error {
+	o, err := e.advertisedOption(name, "button", "")
+	if err != nil {
+		return err
+	}
+
+	return e.SendOption(o.Name, "")
+}
+
+// SetAnalyseMode tells the engine whether it is analysing rather than
+// playing a game with its UCI_AnalyseMode option. An error is returned if the
+// engine does not advertise the option (or UCI has not been called)
+func (e *Engine) SetAnalyseMode(enabled bool) error {
+	o, err := e.advertisedOption("UCI_AnalyseMode", "check", strconv.FormatBool(enabled))
+	if err != nil {
+		return err
+	}
+
+	return e.SendOption(o.Name, o.Value)
+}
+
+// SetLimitStrength limits the engine to play at the given Elo with its
+// UCI_LimitStrength and UCI_Elo options, or turns the limit off, in which case
+// elo is ignored. The engine must advertise both options (UCI_Elo only when
+// limiting) and elo must be within the range of UCI_Elo. Nothing is sent if
+// either check fails
+func (e *Engine) SetLimitStrength(limit bool, elo int) error {
+	o, err := e.advertisedOption("UCI_LimitStrength", "check", strconv.FormatBool(limit))
+	if err != nil {
+		return err
+	}
+
+	if limit {
+		eloOpt, err := e.advertisedOption("UCI_Elo", "spin", strconv.Itoa(elo))
+		if err != nil {
+			return err
+		}
+
+		// set the strength before enabling the limit
+		if err := e.SendOption(eloOpt.Name, eloOpt.Value); err != nil {
+			return err
+		}
+	}
+
+	return e.SendOption(o.Name, o.Value)
+}
+
+// records an option as set, replacing an earlier value of the option. Option
+// names are not case sensitive, and are recorded as advertised by the engine
+// if it has advertised the option. The caller must hold the engine lock
+func (e *Engine) mergeSetOption(o EngOption) {
+	if def, ok := e.findDefaultOption(o.Name); ok {
+		o.Name = def.Name
+	}
+
+	for i, v := range e.setOptions {
+		if strings.EqualFold(v.Name, o.Name) {
+			e.setOptions = append(e.setOptions[:i], e.setOptions[i+1:]...)
+			break
+		}
+	}
+
+	e.setOptions = append(e.setOptions, o)
+}
+
+// SetOptionUpdatePattern makes the parser watch info string messages for
+// engines reporting a change to one of their options, e.g. "Threads set to 4"
+// when the engine adjusts a limit itself. re must have the named groups name
+// and value, e.g.
+//
+//	^(?P<name>\S+) set to (?P<value>\S+)$
+//
+// When a message matches, the option is recorded as set to the value, as if
+// sent with SendOption, so GetSetOptions reflects the engine's state. A nil
+// pattern (the default) turns this off
+func (e *Engine) SetOptionUpdatePattern(re *regexp.Regexp) error {
+	if re != nil && (re.SubexpIndex("name") < 0 || re.SubexpIndex("value") < 0) {
+		return fmt.Errorf("option update pattern %q needs the named groups name and value", re)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.optionUpdate = re
+
+	return nil
+}
+
+// updates the set options if an info string message reports an option
+// change. The caller must hold the engine lock
+func (e *Engine) updateOptionFromInfo(msg string) {
+	if e.optionUpdate == nil {
+		return
+	}
+
+	m := e.optionUpdate.FindStringSubmatch(msg)
+	if m == nil {
+		return
+	}
+
+	o := EngOption{
+		Name:  m[e.optionUpdate.SubexpIndex("name")],
+		Value: m[e.optionUpdate.SubexpIndex("value")],
+	}
+
+	e.mergeSetOption(o)
+}
+
+// SendOptionAck sends an option like SendOption, then waits up to timeout for
+// the engine to acknowledge it with an info string matching ack, e.g.
+// "Hash set to 256". An error is returned if no matching info string is
+// received in time, or the engine exits first
+//
+// Not all engines acknowledge options; use WaitReadyOK to wait for an engine
+// that does not to process the option
+func (e *Engine) SendOptionAck(name, value string, ack *regexp.Regexp, timeout time.Duration) error {
+	if ack == nil {
+		return fmt.Errorf("option %q: no acknowledgement pattern given", name)
+	}
+
+	// subscribe first so an acknowledgement sent straight away is not missed
+	sub, _, _, unsubscribe := e.subscribe()
+	defer unsubscribe()
+
+	if err := e.SendOption(name, value); err != nil {
+		return err
+	}
+
+	timer := time.After(timeout)
+
+	for {
+		select {
+		case info := <-sub.info:
+			if info.String != "" && ack.MatchString(info.String) {
+				return nil
+			}
+		case <-e.chans.parserDone:
+			for len(sub.info) > 0 {
+				if info := <-sub.info; info.String != "" && ack.MatchString(info.String) {
+					return nil
+				}
+			}
+			return fmt.Errorf("option %q not acknowledged: %w", name, ErrEngineExited)
+		case <-timer:
+			return fmt.Errorf("option %q not acknowledged: %w", name, ErrTimeout)
+		}
+	}
+}
+
+// ResetOptions restores the engine's options to the defaults it advertised by
+// sending each spin, check, combo and string option with its default value.
+// Button options have no value and are skipped. The options recorded as set
+// are cleared
+func (e *Engine) ResetOptions() error {
+	for _, o := range e.GetDefaultOptions() {
+		if o.Type == "button" {
+			continue
+		}
+
+		if err := e.SendOption(o.Name, o.Default); err != nil {
+			return err
+		}
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.setOptions = nil
+
+	return nil
+}
+
+// returns a copy of the options that shares no memory with the original
+func copyOptions(opts []EngOption) []EngOption {
+	ret := make([]EngOption, len(opts))
+	for i, o := range opts {
+		ret[i] = o
+		if o.Var != nil {
+			ret[i].Var = make([]string, len(o.Var))
+			copy(ret[i].Var, o.Var)
+		}
+	}
+
+	return ret
+}
+
+// GetSetOptions returns a copy of the options that have been sent to the
+// engine
+func (e *Engine) GetSetOptions() []EngOption {
+	e.RLock()
+	defer e.RUnlock()
+
+	return copyOptions(e.setOptions)
+}
+
+// GetDefaultOptions returns a copy of the options advertised by the engine in
+// response to uci
+func (e *Engine) GetDefaultOptions() []EngOption {
+	e.RLock()
+	defer e.RUnlock()
+
+	return copyOptions(e.defaultOptions)
+}
+
+// OptionTypes returns the name and type of each option advertised by the
+// engine in response to uci, e.g. "Hash" to "spin". The map is empty if uci
+// has not been called
+func (e *Engine) OptionTypes() map[string]string {
+	e.RLock()
+	defer e.RUnlock()
+
+	ret := make(map[string]string, len(e.defaultOptions))
+	for _, o := range e.defaultOptions {
+		ret[o.Name] = o.Type
+	}
+
+	return ret
+}
+
+// OptionRange returns the minimum and maximum of the spin option advertised
+// by the engine with the given name, e.g. Threads or Hash. ok is false if the
+// engine does not advertise the option (or UCI has not been called), it is
+// not a spin option, or its limits are not integers
+func (e *Engine) OptionRange(name string) (lo, hi int, ok bool) {
+	e.RLock()
+	o, found := e.findDefaultOption(name)
+	e.RUnlock()
+
+	if !found || o.Type != "spin" {
+		return 0, 0, false
+	}
+
+	lo, err := strconv.Atoi(o.Min)
+	if err != nil {
+		return 0, 0, false
+	}
+	hi, err = strconv.Atoi(o.Max)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return lo, hi, true
+}
@@ -0,0 +1,778 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// returns a test engine that has advertised the mock engine options
+func newOptionsTestEngine(t *testing.T) (*Engine, *testStdin) {
+	eng, stdin := newTestEngine()
+	feedLines(t, eng, mockOptions...)
+
+	return eng, stdin
+}
+
+func TestSetOptions(t *testing.T) {
+	eng, stdin := newOptionsTestEngine(t)
+
+	err := eng.SetOptions([]EngOption{
+		{Name: "Hash", Value: "128"},
+		{Name: "threads", Value: "4"},
+		{Name: "Style", Value: "Risky"},
+		{Name: "Ponder", Value: "true"},
+		{Name: "Clear Hash"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"setoption name Hash value 128",
+		"setoption name threads value 4",
+		"setoption name Style value Risky",
+		"setoption name Ponder value true",
+		"setoption name Clear Hash",
+		"isready",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q, got %q", expected, stdin.Lines())
+	}
+}
+
+func TestSetOptionsInvalid(t *testing.T) {
+	tt := []struct {
+		name   string
+		option EngOption
+	}{
+		{name: "no name", option: EngOption{Value: "1"}},
+		{name: "unknown option", option: EngOption{Name: "Contempt", Value: "20"}},
+		{name: "spin not an integer", option: EngOption{Name: "Hash", Value: "lots"}},
+		{name: "spin below min", option: EngOption{Name: "Threads", Value: "0"}},
+		{name: "spin above max", option: EngOption{Name: "Threads", Value: "513"}},
+		{name: "check not a bool", option: EngOption{Name: "Ponder", Value: "yes"}},
+		{name: "combo unknown var", option: EngOption{Name: "Style", Value: "Wild"}},
+		{name: "button with value", option: EngOption{Name: "Clear Hash", Value: "true"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			eng, stdin := newOptionsTestEngine(t)
+
+			opts := []EngOption{{Name: "Hash", Value: "64"}, tc.option}
+			if err := eng.SetOptions(opts); err == nil {
+				t.Fatal("expected an error")
+			}
+			if stdin.Len() != 0 {
+				t.Fatalf("no options should be sent, got %q", stdin.String())
+			}
+		})
+	}
+}
+
+func TestResetOptions(t *testing.T) {
+	eng, stdin := newOptionsTestEngine(t)
+
+	if err := eng.SendOption("Hash", "256"); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Reset()
+
+	if err := eng.ResetOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"setoption name Hash value 16",
+		"setoption name Threads value 1",
+		"setoption name MultiPV value 1",
+		"setoption name Ponder value false",
+		"setoption name Style value Normal",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q, got %q", expected, stdin.Lines())
+	}
+
+	eng.RLock()
+	defer eng.RUnlock()
+	if len(eng.setOptions) != 0 {
+		t.Fatalf("expected set options to be cleared, got %+v", eng.setOptions)
+	}
+}
+
+func TestGetOptionsCopies(t *testing.T) {
+	eng, _ := newOptionsTestEngine(t)
+	if err := eng.SendOption("Hash", "128"); err != nil {
+		t.Fatal(err)
+	}
+
+	set := eng.GetSetOptions()
+	if len(set) != 1 || set[0].Name != "Hash" || set[0].Value != "128" {
+		t.Fatalf("unexpected set options %+v", set)
+	}
+	set[0].Value = "1"
+	set = append(set, EngOption{Name: "Threads", Value: "2"})
+
+	if set := eng.GetSetOptions(); len(set) != 1 || set[0].Value != "128" {
+		t.Fatalf("mutating the returned set options changed the engine: %+v", set)
+	}
+
+	defaults := eng.GetDefaultOptions()
+	if len(defaults) != len(mockOptions) {
+		t.Fatalf("expected %d default options, got %d", len(mockOptions), len(defaults))
+	}
+
+	var style int
+	for i, o := range defaults {
+		if o.Name == "Style" {
+			style = i
+		}
+	}
+	defaults[style].Var[0] = "Changed"
+	defaults[0].Default = "Changed"
+
+	defaults = eng.GetDefaultOptions()
+	if defaults[style].Var[0] != "Solid" || defaults[0].Default != "16" {
+		t.Fatalf("mutating the returned default options changed the engine: %+v", defaults)
+	}
+}
+
+func TestSendOptionAck(t *testing.T) {
+	ack := regexp.MustCompile(`^Hash set to 256$`)
+
+	eng := newMockEngine(t, "ack")
+	if err := eng.SendOptionAck("Hash", "256", ack, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// an acknowledgement for another value does not match
+	start := time.Now()
+	if err := eng.SendOptionAck("Hash", "128", ack, 100*time.Millisecond); err == nil {
+		t.Fatal("expected an error for an unmatched acknowledgement")
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("returned before the timeout")
+	}
+
+	// an engine that does not acknowledge options
+	eng = newMockEngine(t)
+	if err := eng.SendOptionAck("Hash", "256", ack, 50*time.Millisecond); err == nil {
+		t.Fatal("expected an error from an engine that does not acknowledge")
+	}
+
+	if err := eng.SendOptionAck("Hash", "256", nil, time.Second); err == nil {
+		t.Fatal("expected an error without an acknowledgement pattern")
+	}
+
+	// an engine exiting while it is waited for
+	time.AfterFunc(50*time.Millisecond, func() { eng.Signal(os.Kill) })
+	start = time.Now()
+	if err := eng.SendOptionAck("Hash", "256", ack, 30*time.Second); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected SendOptionAck to return once the engine exited, took %v", d)
+	}
+}
+
+func TestOptionUpdatePattern(t *testing.T) {
+	if err := (&Engine{}).SetOptionUpdatePattern(regexp.MustCompile(`(\S+) set to (\S+)`)); err == nil {
+		t.Fatal("expected an error for a pattern without named groups")
+	}
+
+	eng := newMockEngine(t, "ack")
+	if err := eng.UCI(); err != nil {
+		t.Fatal(err)
+	}
+
+	// off by default
+	if err := eng.SetOptions([]EngOption{{Name: "Ponder", Value: "true"}}); err != nil {
+		t.Fatal(err)
+	}
+	feedLines(t, eng, "info string Threads set to 2")
+	if set := eng.GetSetOptions(); len(set) != 1 {
+		t.Fatalf("expected only the option sent, got %+v", set)
+	}
+
+	err := eng.SetOptionUpdatePattern(regexp.MustCompile(`^(?P<name>\S+) set to (?P<value>\S+)$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the engine acknowledges the option it was sent
+	if err := eng.SendOptionAck("hash", "64", regexp.MustCompile("set to 64"), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// and reports a change it made itself
+	feedLines(t, eng, "info string threads set to 3", "info string unrelated message")
+
+	expected := []EngOption{
+		{Name: "Ponder", Value: "true"},
+		{Name: "Hash", Value: "64"},
+		{Name: "Threads", Value: "3"},
+	}
+	if set := eng.GetSetOptions(); !reflect.DeepEqual(set, expected) {
+		t.Fatalf("expected set options %+v, got %+v", expected, set)
+	}
+}
+
+func TestSetThreadsAndHash(t *testing.T) {
+	eng, stdin := newOptionsTestEngine(t)
+
+	if err := eng.SetThreads(8); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SetHashMB(256); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"setoption name Threads value 8", "setoption name Hash value 256"}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected %q, got %q", expected, stdin.Lines())
+	}
+
+	stdin.Reset()
+	for _, err := range []error{eng.SetThreads(0), eng.SetThreads(513), eng.SetHashMB(-1)} {
+		if !errors.Is(err, ErrOptionInvalid) {
+			t.Errorf("expected ErrOptionInvalid for an out of range value, got %v", err)
+		}
+	}
+	if stdin.Len() != 0 {
+		t.Errorf("expected nothing to be sent, got %q", stdin.String())
+	}
+
+	// an engine without the options
+	bare, stdin := newTestEngine()
+	feedLines(t, bare, "option name Ponder type check default false", "uciok")
+	if err := bare.SetThreads(2); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid for a missing option, got %v", err)
+	}
+	if err := bare.SetHashMB(64); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid for a missing option, got %v", err)
+	}
+	if stdin.Len() != 0 {
+		t.Errorf("expected nothing to be sent, got %q", stdin.String())
+	}
+}
+
+func TestInternalOptions(t *testing.T) {
+	eng, stdin := newTestEngine()
+	feedLines(t, eng,
+		"option name Hash type spin default 16 min 1 max 1024",
+		"option name UCI_AnalyseMode type check default false",
+		"option name UCI_LimitStrength type check default false",
+		"option name UCI_Elo type spin default 1320 min 1320 max 3190",
+		"uciok",
+	)
+
+	for _, o := range eng.GetDefaultOptions() {
+		if internal := o.Name != "Hash"; o.Internal != internal {
+			t.Errorf("option %s: expected internal %t", o.Name, internal)
+		}
+	}
+
+	if err := eng.SetAnalyseMode(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SetLimitStrength(true, 1500); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SetLimitStrength(false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"setoption name UCI_AnalyseMode value true",
+		"setoption name UCI_Elo value 1500",
+		"setoption name UCI_LimitStrength value true",
+		"setoption name UCI_LimitStrength value false",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected %q, got %q", expected, stdin.Lines())
+	}
+
+	// an Elo out of range sends nothing
+	stdin.Reset()
+	if err := eng.SetLimitStrength(true, 4000); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+	if stdin.Len() != 0 {
+		t.Errorf("expected nothing to be sent, got %q", stdin.String())
+	}
+
+	// the mock engine advertises neither option
+	eng, stdin = newOptionsTestEngine(t)
+	if err := eng.SetAnalyseMode(true); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+	if err := eng.SetLimitStrength(true, 2000); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+	if stdin.Len() != 0 {
+		t.Errorf("expected nothing to be sent, got %q", stdin.String())
+	}
+}
+
+func TestPressButton(t *testing.T) {
+	eng, stdin := newOptionsTestEngine(t)
+
+	if err := eng.PressButton("clear hash"); err != nil {
+		t.Fatal(err)
+	}
+	if stdin.String() != "setoption name Clear Hash\n" {
+		t.Fatalf("unexpected command %q", stdin.String())
+	}
+
+	stdin.Reset()
+	for _, name := range []string{"Hash", "Ponder", "Clear Cache"} {
+		if err := eng.PressButton(name); !errors.Is(err, ErrOptionInvalid) {
+			t.Errorf("%s: expected ErrOptionInvalid, got %v", name, err)
+		}
+	}
+
+	// a button cannot be sent a value
+	err := eng.SetOptions([]EngOption{{Name: "Clear Hash", Value: "true"}})
+	if !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+	if stdin.Len() != 0 {
+		t.Errorf("expected nothing to be sent, got %q", stdin.String())
+	}
+}
+
+func TestBatchOptions(t *testing.T) {
+	eng, stdin := newOptionsTestEngine(t)
+
+	if err := eng.SetBatchOptions(true); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range [][2]string{{"Hash", "64"}, {"Threads", "2"}, {"Clear Hash", ""}} {
+		if err := eng.SendOption(o[0], o[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stdin.Len() != 0 {
+		t.Fatalf("expected the options to be held back, got %q", stdin.String())
+	}
+
+	if err := eng.CommitOptions(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"setoption name Hash value 64",
+		"setoption name Threads value 2",
+		"setoption name Clear Hash",
+	}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected %q, got %q", expected, stdin.Lines())
+	}
+
+	// isready flushes the options ahead of it
+	stdin.Reset()
+	if err := eng.SetThreads(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.WaitReadyOK(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"setoption name Threads value 4", "isready"}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected %q, got %q", expected, stdin.Lines())
+	}
+
+	// turning batch mode off commits and flushes every option again
+	stdin.Reset()
+	eng.SendOption("Hash", "128")
+	if err := eng.SetBatchOptions(false); err != nil {
+		t.Fatal(err)
+	}
+	eng.SendOption("Hash", "256")
+	expected = []string{"setoption name Hash value 128", "setoption name Hash value 256"}
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected %q, got %q", expected, stdin.Lines())
+	}
+}
+
+// countingWriter counts the writes reaching it, each standing in for a
+// system call writing to the engine's stdin
+type countingWriter struct {
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+func BenchmarkSendOptions(b *testing.B) {
+	const options = 40
+
+	for _, batch := range []bool{false, true} {
+		name := "flush"
+		if batch {
+			name = "batched"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer pr.Close()
+			defer pw.Close()
+			go io.Copy(io.Discard, pr)
+
+			eng, _ := newTestEngine()
+			counter := &countingWriter{}
+			eng.stdin = bufio.NewWriter(io.MultiWriter(counter, pw))
+			eng.SetBatchOptions(batch)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for o := 0; o < options; o++ {
+					eng.SendOption(fmt.Sprintf("Option%d", o), strconv.Itoa(i))
+				}
+				eng.CommitOptions()
+			}
+			b.ReportMetric(float64(counter.writes)/float64(b.N), "writes/op")
+		})
+	}
+}
+
+func TestPresets(t *testing.T) {
+	entry := strings.TrimSuffix(mockConfigEntry("presets", 0), "}") + `,
+		"presets": {
+			"analysis": [
+				{"name": "Threads", "value": "8"},
+				{"name": "MultiPV", "value": "3"},
+				{"name": "Style", "value": "Solid"}
+			],
+			"blitz": [
+				{"name": "Threads", "value": "2"},
+				{"name": "MultiPV", "value": "1"},
+				{"name": "Hash", "value": "64"}
+			]
+		}}`
+
+	engs, err := NewEnginesFromConfig(writeMockConfig(t, entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng := engs[0]
+	defer eng.Close()
+
+	eng.SetRecordCommands(true)
+	if err := eng.ApplyPreset("blitz"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"setoption name Threads value 2",
+		"setoption name MultiPV value 1",
+		"setoption name Hash value 64",
+		"isready",
+	}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %q, got %q", expected, cmds)
+	}
+
+	if err := eng.ApplyPreset("bullet"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+
+	// presets are validated like any other options
+	eng.AddPreset("broken", []EngOption{{Name: "Threads", Value: "0"}})
+	if err := eng.ApplyPreset("broken"); !errors.Is(err, ErrOptionInvalid) {
+		t.Errorf("expected ErrOptionInvalid, got %v", err)
+	}
+
+	// mistakes in a preset from the config are reported at startup
+	entry = strings.TrimSuffix(mockConfigEntry("typo", 0), "}") + `,
+		"presets": {
+			"analysis": [
+				{"name": "Threads", "value": "8"},
+				{"name": "MultiPv", "value": "3"},
+				{"name": "Hsah", "value": "64"}
+			]
+		}}`
+
+	if _, err = NewEnginesFromConfig(writeMockConfig(t, entry)); !errors.Is(err, ErrOptionInvalid) {
+		t.Fatalf("expected ErrOptionInvalid for a misspelt option, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `preset "analysis"`) || !strings.Contains(err.Error(), "Hsah") {
+		t.Errorf("expected the error to name the preset and option, got %v", err)
+	}
+}
+
+func TestParseOption(t *testing.T) {
+	tt := []struct {
+		name   string
+		line   string
+		option EngOption
+	}{
+		{
+			name:   "spin",
+			line:   "option name Hash type spin default 16 min 1 max 33554432",
+			option: EngOption{Name: "Hash", Type: "spin", Default: "16", Min: "1", Max: "33554432"},
+		},
+		{
+			name:   "check",
+			line:   "option name Ponder type check default false",
+			option: EngOption{Name: "Ponder", Type: "check", Default: "false"},
+		},
+		{
+			name: "combo",
+			line: "option name Analysis Contempt type combo default Both var Off var White var Black var Both",
+			option: EngOption{
+				Name:    "Analysis Contempt",
+				Type:    "combo",
+				Default: "Both",
+				Var:     []string{"Off", "White", "Black", "Both"},
+			},
+		},
+		{
+			name:   "string",
+			line:   "option name Debug Log File type string default <empty>",
+			option: EngOption{Name: "Debug Log File", Type: "string"},
+		},
+		{
+			name:   "string with spaces",
+			line:   "option name Book File type string default  /opt/books/main book.bin",
+			option: EngOption{Name: "Book File", Type: "string", Default: "/opt/books/main book.bin"},
+		},
+		{
+			name:   "button",
+			line:   "option name Clear Hash type button",
+			option: EngOption{Name: "Clear Hash", Type: "button"},
+		},
+		{
+			name:   "internal",
+			line:   "option name UCI_Elo type spin default 1320 min 1320 max 3190",
+			option: EngOption{Name: "UCI_Elo", Type: "spin", Default: "1320", Min: "1320", Max: "3190", Internal: true},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := ParseOption(tc.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(o, tc.option) {
+				t.Errorf("expected %+v, got %+v", tc.option, o)
+			}
+		})
+	}
+
+	for _, bad := range []string{
+		"",
+		"id name Stockfish",
+		"option type spin default 1",
+		"option name Hash",
+	} {
+		if o, err := ParseOption(bad); err == nil {
+			t.Errorf("%q: expected an error, got %+v", bad, o)
+		}
+	}
+}
+
+func TestParseOptionReservedWords(t *testing.T) {
+	tt := []struct {
+		name   string
+		line   string
+		option EngOption
+	}{
+		{
+			name:   "name ending in default",
+			line:   "option name Use NNUE default type check default true",
+			option: EngOption{Name: "Use NNUE default", Type: "check", Default: "true"},
+		},
+		{
+			name:   "name with min and max",
+			line:   "option name min max Threads type spin default 1 min 1 max 512",
+			option: EngOption{Name: "min max Threads", Type: "spin", Default: "1", Min: "1", Max: "512"},
+		},
+		{
+			name:   "name with type and var",
+			line:   "option name var type name type string default x",
+			option: EngOption{Name: "var type name", Type: "string", Default: "x"},
+		},
+		{
+			name:   "string default with keywords",
+			line:   "option name Note type string default use max threads by default",
+			option: EngOption{Name: "Note", Type: "string", Default: "use max threads by default"},
+		},
+		{
+			name: "combo values that are keywords",
+			line: "option name Level type combo default max var min var max var default",
+			option: EngOption{
+				Name:    "Level",
+				Type:    "combo",
+				Default: "max",
+				Var:     []string{"min", "max", "default"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := ParseOption(tc.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(o, tc.option) {
+				t.Errorf("expected %+v, got %+v", tc.option, o)
+			}
+		})
+	}
+}
+
+func TestParseOptionComboSpaces(t *testing.T) {
+	tt := []struct {
+		name    string
+		line    string
+		def     string
+		choices []string
+	}{
+		{
+			name:    "multi-word values",
+			line:    "option name Speed type combo default Very Fast var Very Fast var Normal var Very Slow",
+			def:     "Very Fast",
+			choices: []string{"Very Fast", "Normal", "Very Slow"},
+		},
+		{
+			name:    "single and multi-word values",
+			line:    "option name Style type combo default Normal var Solid var Normal var Very Risky Indeed",
+			def:     "Normal",
+			choices: []string{"Solid", "Normal", "Very Risky Indeed"},
+		},
+		{
+			name:    "empty value",
+			line:    "option name Book type combo default <empty> var <empty> var Main Book",
+			def:     "",
+			choices: []string{"", "Main Book"},
+		},
+		{
+			name:    "without a default",
+			line:    "option name Mode type combo var Fast Mode var Slow Mode",
+			choices: []string{"Fast Mode", "Slow Mode"},
+		},
+		{
+			name:    "extra spacing and a trailing var",
+			line:    "option name Speed type combo default Fast  var  Fast\tvar Very   Slow var",
+			def:     "Fast",
+			choices: []string{"Fast", "Very Slow"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := ParseOption(tc.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Default != tc.def {
+				t.Errorf("expected default %q, got %q", tc.def, o.Default)
+			}
+			if !reflect.DeepEqual(o.Var, tc.choices) {
+				t.Errorf("expected vars %q, got %q", tc.choices, o.Var)
+			}
+		})
+	}
+
+	// a multi-word value is accepted when set
+	eng, stdin := newOptionsTestEngine(t)
+	feedLines(t, eng, "option name Speed type combo default Normal var Very Fast var Normal")
+	stdin.Reset()
+	if err := eng.SetOptions([]EngOption{{Name: "Speed", Value: "Very Fast"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdin.String(), "setoption name Speed value Very Fast\n") {
+		t.Errorf("expected the value to be sent, got %q", stdin.String())
+	}
+}
+
+func TestOptionTypes(t *testing.T) {
+	eng, _ := newTestEngine()
+	if types := eng.OptionTypes(); len(types) != 0 {
+		t.Fatalf("expected no options before uci, got %v", types)
+	}
+
+	feedLines(t, eng,
+		"option name Hash type spin default 16 min 1 max 33554432",
+		"option name Ponder type check default false",
+		"option name Clear Hash type button",
+		"option name SyzygyPath type string default <empty>",
+		"option name Analysis Contempt type combo default Both var Off var Both",
+	)
+
+	expected := map[string]string{
+		"Hash":              "spin",
+		"Ponder":            "check",
+		"Clear Hash":        "button",
+		"SyzygyPath":        "string",
+		"Analysis Contempt": "combo",
+	}
+	if types := eng.OptionTypes(); !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v, got %v", expected, types)
+	}
+}
+
+func TestOptionRange(t *testing.T) {
+	eng, _ := newTestEngine()
+	feedLines(t, eng,
+		"option name Threads type spin default 1 min 1 max 512",
+		"option name Hash type spin default 16 min 1 max 33554432",
+		"option name Contempt type spin default 0 min -100 max 100",
+		"option name Broken type spin default 1 min one max 2",
+		"option name Ponder type check default false",
+	)
+
+	tt := []struct {
+		name     string
+		min, max int
+		ok       bool
+	}{
+		{name: "Threads", min: 1, max: 512, ok: true},
+		{name: "hash", min: 1, max: 33554432, ok: true},
+		{name: "Contempt", min: -100, max: 100, ok: true},
+		{name: "Broken"},
+		{name: "Ponder"},
+		{name: "Missing"},
+	}
+
+	for _, tc := range tt {
+		min, max, ok := eng.OptionRange(tc.name)
+		if min != tc.min || max != tc.max || ok != tc.ok {
+			t.Errorf("%s: expected %d, %d, %v, got %d, %d, %v",
+				tc.name, tc.min, tc.max, tc.ok, min, max, ok)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Pool is a set of identical engines that analyze positions concurrently.
+// Each request is given an idle engine, so up to Size requests run at once
+// and further requests wait for an engine to become idle
+type Pool struct {
+	engines   []*Engine
+	mu        sync.Mutex    // guards engines
+	idle      chan *Engine  // engines not analyzing a position
+	done      chan struct{} // closed when the pool is closed
+	empty     chan struct{} // closed once every engine has been removed
+	closeOnce sync.Once
+}
+
+// NewPool starts n engines from the program at path, configured by opts and
+// started with args, runs the uci handshake on each and returns them as a
+// pool
+func NewPool(path string, n int, opts EngineOptions, args ...string) (*Pool, error) {
+	if n < 1 {
+		return nil, errors.New("pool needs at least one engine")
+	}
+
+	eng, err := NewEngineWithOptions(path, opts, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = eng.uci(defaultReadyTimeout); err != nil {
+		eng.Close()
+		return nil, err
+	}
+
+	return NewPoolFromEngine(eng, n)
+}
+
+// NewPoolFromEngine returns a pool of n engines: eng, which must have been
+// started from a path, and n-1 clones of it. Options set on eng before
+// calling NewPoolFromEngine are set on the clones too. If a clone cannot be
+// started, all engines including eng are closed
+func NewPoolFromEngine(eng *Engine, n int) (*Pool, error) {
+	if n < 1 {
+		return nil, errors.New("pool needs at least one engine")
+	}
+
+	p := &Pool{
+		engines: []*Engine{eng},
+		idle:    make(chan *Engine, n),
+		done:    make(chan struct{}),
+		empty:   make(chan struct{}),
+	}
+
+	for i := 1; i < n; i++ {
+		clone, err := eng.Clone()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+
+		p.engines = append(p.engines, clone)
+	}
+
+	for _, e := range p.engines {
+		p.idle <- e
+	}
+
+	return p, nil
+}
+
+// Size returns the number of engines in the pool, which shrinks as engines
+// that exit or stop responding are removed
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.engines)
+}
+
+// Idle returns the number of engines not analyzing a position
+func (p *Pool) Idle() int {
+	return len(p.idle)
+}
+
+// Analyze waits for an idle engine and searches the position given by fen
+// with it, as AnalyzeBatch does for a single position, returning the
+// bestmove. The engine is returned to the pool once the search has ended
+//
+// If ctx is cancelled while waiting for an engine, or during the search, the
+// context's error is returned. If the engine exits during the search, or is
+// shut down by Close, an error wrapping ErrEngineExited is returned
+//
+// After a failed search the engine is only returned to the pool once it has
+// stopped searching. An engine that has exited, or does not stop, is closed
+// and removed from the pool instead. When no engines are left, Analyze
+// returns an error
+func (p *Pool) Analyze(ctx context.Context, fen string, params GoParams) (BestMove, error) {
+	var eng *Engine
+
+	select {
+	case <-p.done:
+		return BestMove{}, errors.New("pool closed")
+	case <-p.empty:
+		return BestMove{}, errors.New("pool has no engines left")
+	default:
+	}
+
+	select {
+	case eng = <-p.idle:
+	case <-p.done:
+		return BestMove{}, errors.New("pool closed")
+	case <-p.empty:
+		return BestMove{}, errors.New("pool has no engines left")
+	case <-ctx.Done():
+		return BestMove{}, ctx.Err()
+	}
+
+	results, err := eng.AnalyzeBatch(ctx, []string{fen}, params)
+	if err != nil {
+		p.release(eng)
+
+		select {
+		case <-p.done:
+			return BestMove{}, fmt.Errorf("pool closed: %w", err)
+		default:
+		}
+		return BestMove{}, err
+	}
+	p.idle <- eng
+
+	return results[0], nil
+}
+
+// returns eng to the pool after a failed search once it has stopped
+// searching, or closes and removes it if it has exited or does not stop
+func (p *Pool) release(eng *Engine) {
+	_, err := eng.StopAndWait(defaultReadyTimeout)
+	if err == nil {
+		eng.RLock()
+		if eng.outputDone {
+			err = ErrEngineExited
+		}
+		eng.RUnlock()
+	}
+
+	if err == nil {
+		p.idle <- eng
+		return
+	}
+
+	eng.Close()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if i := slices.Index(p.engines, eng); i >= 0 {
+		p.engines = slices.Delete(p.engines, i, i+1)
+		if len(p.engines) == 0 {
+			close(p.empty)
+		}
+	}
+}
+
+// Close shuts down every engine in the pool. Analysis requests in progress
+// and made after Close return an error
+func (p *Pool) Close() error {
+	var errs []error
+
+	p.closeOnce.Do(func() {
+		close(p.done)
+
+		p.mu.Lock()
+		engines := slices.Clone(p.engines)
+		p.mu.Unlock()
+
+		for _, e := range engines {
+			if err := e.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+
+	return errors.Join(errs...)
+}
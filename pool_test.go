@@ -0,0 +1,200 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+
+	pool, err := NewPool(os.Args[0], 3, EngineOptions{}, "move:"+fen+"=c7c5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	if pool.Size() != 3 || pool.Idle() != 3 {
+		t.Fatalf("expected 3 idle engines, got %d of %d", pool.Idle(), pool.Size())
+	}
+
+	b, err := pool.Analyze(context.Background(), fen, GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "c7c5" {
+		t.Fatalf("expected bestmove c7c5, got %+v", b)
+	}
+
+	// concurrent requests each get their own engine, as an engine can only
+	// run one search at a time
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pool.Analyze(ctx, fen, GoParams{Infinite: true})
+			errs <- err
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Idle() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all engines to be busy, %d idle", pool.Idle())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// a further request waits for an idle engine
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	if _, err = pool.Analyze(waitCtx, fen, GoParams{Depth: 2}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the request to time out waiting for an engine, got %v", err)
+	}
+
+	cancel()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	}
+	if pool.Idle() != 3 {
+		t.Fatalf("expected the engines to be returned to the pool, %d idle", pool.Idle())
+	}
+
+	if err = pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pool.Analyze(context.Background(), fen, GoParams{Depth: 2}); err == nil {
+		t.Fatal("expected an error analyzing with a closed pool")
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+
+	pool, err := NewPool(os.Args[0], 1, EngineOptions{}, "move:"+fen+"=c7c5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := pool.Analyze(ctx, fen, GoParams{Infinite: true})
+		errc <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Idle() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the engine to be busy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err = <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// the stopped engine is back in the pool and searches the next position
+	if pool.Size() != 1 || pool.Idle() != 1 {
+		t.Fatalf("expected the engine to be returned to the pool, got %d idle of %d", pool.Idle(), pool.Size())
+	}
+
+	b, err := pool.Analyze(context.Background(), fen, GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "c7c5" {
+		t.Fatalf("expected bestmove c7c5, got %+v", b)
+	}
+}
+
+func TestPoolEngineExited(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+
+	// an engine crashing during the search
+	pool, err := NewPool(os.Args[0], 1, EngineOptions{}, "partial:info depth 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	if _, err = pool.Analyze(context.Background(), fen, GoParams{Depth: 5}); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited, got %v", err)
+	}
+	if pool.Size() != 0 || pool.Idle() != 0 {
+		t.Fatalf("expected the engine to be removed, got %d idle of %d", pool.Idle(), pool.Size())
+	}
+
+	// the request fails rather than waiting for an engine that never returns
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err = pool.Analyze(ctx, fen, GoParams{Depth: 5}); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected an error from an empty pool, got %v", err)
+	}
+
+	// an engine shut down by Close during the search
+	pool, err = NewPool(os.Args[0], 1, EngineOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	errc := make(chan error)
+	go func() {
+		_, err := pool.Analyze(context.Background(), fen, GoParams{Infinite: true})
+		errc <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Idle() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the engine to be busy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err = pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err = <-errc:
+		if !errors.Is(err, ErrEngineExited) {
+			t.Fatalf("expected ErrEngineExited, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close to end the analysis in progress")
+	}
+}
@@ -0,0 +1,140 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"maps"
+	"os"
+)
+
+// PID returns the process id of the engine, or -1 if the engine process has
+// not been started
+func (e *Engine) PID() int {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return -1
+	}
+
+	return e.cmd.Process.Pid
+}
+
+// CommandLine returns the program path and arguments the engine process was
+// started with, or nil if the engine is not backed by a process
+func (e *Engine) CommandLine() []string {
+	if e.cmd == nil {
+		return nil
+	}
+
+	return append([]string(nil), e.cmd.Args...)
+}
+
+// Signal sends a signal to the engine process, e.g. to change its priority
+// from a supervisor. Not all signals are supported on all platforms; see
+// os.Process.Signal
+func (e *Engine) Signal(sig os.Signal) error {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return errors.New("engine process not started")
+	}
+
+	return e.cmd.Process.Signal(sig)
+}
+
+// Close shuts down the engine without waiting for it to quit: the engine
+// process is killed if it is still running, and the engine output is no
+// longer parsed. Use SendQuit to ask the engine to exit cleanly instead
+//
+// Only the engine process is killed. If a process it started holds the
+// engine output open, the output is abandoned after 5 seconds, or the
+// WaitDelay of the command given to NewEngineFromCmd
+//
+// It is safe to call Close more than once, and after SendQuit
+func (e *Engine) Close() error {
+	var err error
+
+	e.closeOnce.Do(func() {
+		if e.exited != nil {
+			select {
+			case <-e.exited:
+			default:
+				kerr := e.cmd.Process.Kill()
+				if kerr != nil && !errors.Is(kerr, os.ErrProcessDone) {
+					err = kerr
+					break
+				}
+				<-e.exited
+			}
+		}
+
+		close(e.chans.doneStdout)
+	})
+
+	return err
+}
+
+// Clone starts another instance of the engine program with the same path,
+// arguments and EngineOptions, runs the uci handshake and sends the options
+// that have been set on this engine. Settings made on this engine with
+// SetLogger, SetQueueBestMoves, SetKeepInfoHistory, SetOptionUpdatePattern,
+// SetInfoStringJoin, SetSANConverter and SetQuitGrace are copied too
+//
+// This makes it simple to set up several identical engines to search in
+// parallel
+func (e *Engine) Clone() (*Engine, error) {
+	if e.path == "" {
+		return nil, errors.New("engine was not started from a path")
+	}
+
+	clone, err := NewEngineWithOptions(e.path, e.opts, e.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	clone.SetLogger(e.logger.Load())
+
+	e.RLock()
+	clone.queueBestMoves = e.queueBestMoves
+	clone.keepInfoHistory = e.keepInfoHistory
+	clone.ignoreEchoes = e.ignoreEchoes
+	clone.joinStrings = e.joinStrings
+	clone.quitGrace = e.quitGrace
+	clone.optionUpdate = e.optionUpdate
+	clone.presets = maps.Clone(e.presets)
+	clone.chess960 = e.chess960
+	clone.multiPV = e.multiPV
+	clone.sanConverter = e.sanConverter
+	e.RUnlock()
+
+	if err = clone.uci(defaultReadyTimeout); err != nil {
+		clone.Close()
+		return nil, err
+	}
+
+	for _, o := range e.GetSetOptions() {
+		if err = clone.SendOption(o.Name, o.Value); err != nil {
+			clone.Close()
+			return nil, err
+		}
+	}
+
+	if err = clone.WaitReadyOK(defaultReadyTimeout); err != nil {
+		clone.Close()
+		return nil, err
+	}
+
+	return clone, nil
+}
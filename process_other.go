@@ -0,0 +1,36 @@
+//go:build (!unix && !windows) || aix || solaris
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+)
+
+// Pause suspends the engine process. It is not supported on this platform
+// and returns errors.ErrUnsupported
+func (e *Engine) Pause() error {
+	return errors.ErrUnsupported
+}
+
+// Resume continues an engine suspended with Pause. It is not supported on
+// this platform and returns errors.ErrUnsupported
+func (e *Engine) Resume() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,36 @@
+//go:build (!unix && !windows) || aix || solaris
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPauseResume(t *testing.T) {
+	eng := newMockEngine(t)
+
+	if err := eng.Pause(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Pause: expected errors.ErrUnsupported, got %v", err)
+	}
+	if err := eng.Resume(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Resume: expected errors.ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build windows
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"syscall"
+	"testing"
+)
+
+// the exit code GetExitCodeProcess reports for a process still running
+const stillActive = 259
+
+// returns true if the process with the given pid is still running
+func processRunning(t *testing.T, pid int) bool {
+	t.Helper()
+
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err = syscall.GetExitCodeProcess(h, &code); err != nil {
+		t.Fatalf("checking process %d: %v", pid, err)
+	}
+
+	return code == stillActive
+}
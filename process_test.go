@@ -0,0 +1,354 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPID(t *testing.T) {
+	eng, _ := newTestEngine()
+	if pid := eng.PID(); pid != -1 {
+		t.Fatalf("expected pid -1 for engine without a process, got %d", pid)
+	}
+	if err := eng.Signal(os.Kill); err == nil {
+		t.Fatal("expected error signalling engine without a process")
+	}
+
+	eng = newMockEngine(t)
+
+	pid := eng.PID()
+	if pid <= 0 || pid == os.Getpid() {
+		t.Fatalf("unexpected engine pid %d", pid)
+	}
+
+	// the process should be alive and answering
+	if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	eng := newMockEngine(t)
+	pid := eng.PID()
+	if !processRunning(t, pid) {
+		t.Fatal("engine process not running")
+	}
+
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if processRunning(t, pid) {
+		t.Fatal("engine process still running after Close")
+	}
+
+	// closing again is harmless
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an engine that has quit can be closed
+	eng = newMockEngine(t)
+	if err := eng.SendQuit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if eng.cmd.WaitDelay != outputWaitDelay {
+		t.Errorf("expected a WaitDelay of %v, got %v", outputWaitDelay, eng.cmd.WaitDelay)
+	}
+}
+
+// returns the process id of the process started by a mock engine run with
+// grandchild:<pidfile>, and kills the process when the test finishes
+func killGrandchild(t *testing.T, pidfile string) int {
+	t.Helper()
+
+	raw, err := os.ReadFile(pidfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(string(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
+	})
+
+	return pid
+}
+
+func TestCloseOutputHeldOpen(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "grandchild.pid")
+
+	cmd := exec.Command(os.Args[0], "grandchild:"+pidfile)
+	cmd.WaitDelay = 100 * time.Millisecond
+	eng, err := NewEngineFromCmd(cmd, "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	if err = eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	pid := killGrandchild(t, pidfile)
+
+	// the process started by the engine keeps the engine output open
+	done := make(chan error)
+	go func() { done <- eng.Close() }()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for a process holding the engine output open")
+	}
+	if !processRunning(t, pid) {
+		t.Fatal("expected the process started by the engine to be left running")
+	}
+}
+
+func TestNewEnginesFromConfigCleanup(t *testing.T) {
+	dir := t.TempDir()
+	pidfile := func(i int) string {
+		return filepath.Join(dir, strconv.Itoa(i)+".pid")
+	}
+
+	path := writeMockConfig(t,
+		mockConfigEntry("first", 0, "pidfile:"+pidfile(0)),
+		mockConfigEntry("second", 0, "pidfile:"+pidfile(1)),
+		`{"path": "`+filepath.Join(dir, "missing")+`"}`,
+		mockConfigEntry("fourth", 0),
+	)
+
+	if _, err := NewEnginesFromConfig(path); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for i := 0; i < 2; i++ {
+		raw, err := os.ReadFile(pidfile(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if processRunning(t, pid) {
+			t.Errorf("engine %d (pid %d) left running", i, pid)
+		}
+	}
+}
+
+func TestPartialLineOnExit(t *testing.T) {
+	eng := newMockEngine(t, "partial:bestmove d2d4")
+
+	if err := eng.Go(GoParams{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the engine exits without terminating the bestmove line
+	b, err := eng.WaitBestMove(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "d2d4" {
+		t.Fatalf("expected bestmove d2d4, got %+v", b)
+	}
+}
+
+func TestSendQuit(t *testing.T) {
+	eng := newMockEngine(t)
+
+	// the output of a search finished before quit is still parsed
+	if err := eng.Go(GoParams{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := eng.SendQuit(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected quit to complete promptly, took %v", d)
+	}
+
+	if eng.IsSearching() {
+		t.Fatal("expected the bestmove to be parsed before quit returned")
+	}
+	if n := len(eng.GetInfo(-1)); n != 2 {
+		t.Fatalf("expected 2 info lines parsed before quit returned, got %d", n)
+	}
+	if b, err := eng.WaitBestMove(time.Second); err != nil || b.BestMove != "e2e4" {
+		t.Fatalf("expected bestmove e2e4, got %+v, %v", b, err)
+	}
+}
+
+func TestSendQuitGrace(t *testing.T) {
+	eng := newMockEngine(t, "noquit")
+	pid := eng.PID()
+	eng.SetQuitGrace(200 * time.Millisecond)
+
+	start := time.Now()
+	err := eng.SendQuit()
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected an engine ignoring quit to time out, got %v", err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond || d > 3*time.Second {
+		t.Errorf("expected the engine to be killed after the grace period, took %v", d)
+	}
+	if processRunning(t, pid) {
+		t.Fatal("engine process still running after the grace period")
+	}
+
+	// the engine is killed even if a process it started holds its output open
+	pidfile := filepath.Join(t.TempDir(), "grandchild.pid")
+	cmd := exec.Command(os.Args[0], "noquit", "grandchild:"+pidfile)
+	cmd.WaitDelay = 100 * time.Millisecond
+	if eng, err = NewEngineFromCmd(cmd, "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	if err = eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	killGrandchild(t, pidfile)
+
+	pid = eng.PID()
+	eng.SetQuitGrace(200 * time.Millisecond)
+
+	start = time.Now()
+	if err = eng.SendQuit(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected an engine ignoring quit to time out, got %v", err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("expected quit to return once the output was abandoned, took %v", d)
+	}
+	if processRunning(t, pid) {
+		t.Fatal("engine process still running after the grace period")
+	}
+
+	// an engine that quits is not killed
+	eng = newMockEngine(t)
+	eng.SetQuitGrace(time.Minute)
+	if err = eng.SendQuit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	eng := newMockEngine(t, "ack")
+	if err := eng.UCI(); err != nil {
+		t.Fatal(err)
+	}
+	err := eng.SetOptions([]EngOption{
+		{Name: "Hash", Value: "64"},
+		{Name: "Style", Value: "Risky"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := eng.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clone.Close() })
+
+	if clone.PID() == eng.PID() {
+		t.Fatal("expected the clone to run in its own process")
+	}
+	if !reflect.DeepEqual(clone.GetSetOptions(), eng.GetSetOptions()) {
+		t.Fatalf("expected set options %+v, got %+v", eng.GetSetOptions(), clone.GetSetOptions())
+	}
+	if n := len(clone.GetDefaultOptions()); n != len(mockOptions) {
+		t.Fatalf("expected the clone to have completed the handshake, got %d options", n)
+	}
+
+	// the clone was started with the same arguments, so acknowledges options
+	if err = clone.SendOptionAck("Threads", "2", regexp.MustCompile("Threads set to 2"), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	eng, _ = newTestEngine()
+	if _, err = eng.Clone(); err == nil {
+		t.Fatal("expected an error cloning an engine without a process")
+	}
+}
+
+func TestNewEngineMissingProgram(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	path := filepath.Join(t.TempDir(), "no-such-engine")
+	eng, err := NewEngineFromPath(path, "", 0, 0)
+	if err == nil {
+		eng.Close()
+		t.Fatal("expected an error for a missing program")
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	if !strings.Contains(err.Error(), path) {
+		t.Errorf("expected the error to name the program, got %v", err)
+	}
+
+	// give any goroutine that was started a moment to show up
+	time.Sleep(50 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected no goroutines to be left running, %d before and %d after", before, after)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	eng := newMockEngine(t, "ack", "move:startpos=d2d4")
+
+	expected := []string{os.Args[0], "ack", "move:startpos=d2d4"}
+	cmdLine := eng.CommandLine()
+	if !reflect.DeepEqual(cmdLine, expected) {
+		t.Fatalf("expected %q, got %q", expected, cmdLine)
+	}
+
+	// the slice returned is a copy
+	cmdLine[1] = "noreadyok"
+	if !reflect.DeepEqual(eng.CommandLine(), expected) {
+		t.Errorf("expected the command line to be unchanged, got %q", eng.CommandLine())
+	}
+
+	if eng, _ := newTestEngine(); eng.CommandLine() != nil {
+		t.Errorf("expected no command line without a process, got %q", eng.CommandLine())
+	}
+}
@@ -0,0 +1,70 @@
+//go:build unix && !aix && !solaris
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Pause suspends the engine process with SIGSTOP, so it uses no CPU while
+// keeping its state, such as a search in progress and its hash
+//
+// Engines started by NewEngineFromPath and NewEngineWithOptions stay in the
+// process group of the program using them, so only the engine process is
+// suspended and any helper processes it started keep running. To suspend
+// those too, start the engine with NewEngineFromCmd and SysProcAttr.Setpgid
+// set: the whole group of an engine that leads its own group is suspended
+//
+// A paused engine reads no commands and sends no output, so waits such as
+// WaitReadyOK time out until Resume is called. Pause and Resume are supported
+// on Windows and on Unix other than AIX and Solaris (including illumos);
+// elsewhere they return errors.ErrUnsupported
+func (e *Engine) Pause() error {
+	return e.signalGroup(syscall.SIGSTOP)
+}
+
+// Resume continues an engine suspended with Pause, with SIGCONT
+func (e *Engine) Resume() error {
+	return e.signalGroup(syscall.SIGCONT)
+}
+
+// sends sig to the engine's process group if the engine leads it, and to the
+// engine process alone otherwise, so the group of the program using the
+// engine is never signalled
+func (e *Engine) signalGroup(sig syscall.Signal) error {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return errors.New("engine process not started")
+	}
+
+	select {
+	case <-e.exited:
+		return fmt.Errorf("%w: sending %v", ErrEngineExited, sig)
+	default:
+	}
+
+	pid := e.cmd.Process.Pid
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		return syscall.Kill(-pid, sig)
+	}
+
+	return e.cmd.Process.Signal(sig)
+}
@@ -0,0 +1,120 @@
+//go:build unix && !aix && !solaris
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// returns the state of a process as shown by ps, e.g. "T" when stopped, or
+// "" if it cannot be found
+func processState(t *testing.T, pid int) string {
+	t.Helper()
+
+	out, err := exec.Command("ps", "-o", "state=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+func TestPauseResume(t *testing.T) {
+	if _, err := exec.LookPath("ps"); err != nil {
+		t.Skip("no ps to inspect the engine process with")
+	}
+
+	eng, _ := newTestEngine()
+	if err := eng.Pause(); err == nil {
+		t.Fatal("expected an error pausing an engine without a process")
+	}
+
+	// each engine starts a helper process, which is only suspended along
+	// with an engine leading its own process group
+	tt := []struct {
+		name  string
+		group bool
+	}{
+		{name: "process"},
+		{name: "process group", group: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			pidfile := filepath.Join(t.TempDir(), "grandchild.pid")
+			cmd := exec.Command(os.Args[0], "grandchild:"+pidfile)
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: tc.group}
+			eng, err := NewEngineFromCmd(cmd, "", 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { eng.Close() })
+
+			if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+			helper := killGrandchild(t, pidfile)
+
+			if err := eng.Pause(); err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for processState(t, eng.PID()) != "T" && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if s := processState(t, eng.PID()); s != "T" {
+				t.Fatalf("expected the engine to be stopped, its state is %q", s)
+			}
+			if err := eng.WaitReadyOK(100 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expected a paused engine not to answer, got %v", err)
+			}
+			if stopped := processState(t, helper) == "T"; stopped != tc.group {
+				t.Fatalf("expected the helper process to be stopped: %v, got %v", tc.group, stopped)
+			}
+
+			if err := eng.Resume(); err != nil {
+				t.Fatal(err)
+			}
+			if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if s := processState(t, eng.PID()); s == "T" {
+				t.Fatal("expected the engine to run again")
+			}
+		})
+	}
+
+	// an engine that has exited cannot be paused
+	eng = newMockEngine(t)
+	if err := eng.SendQuit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Pause(); !errors.Is(err, ErrEngineExited) {
+		t.Errorf("expected ErrEngineExited, got %v", err)
+	}
+}
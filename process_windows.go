@@ -0,0 +1,79 @@
+//go:build windows
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// access right needed to suspend and resume a process
+const processSuspendResume = 0x0800
+
+var (
+	ntdll            = syscall.NewLazyDLL("ntdll.dll")
+	ntSuspendProcess = ntdll.NewProc("NtSuspendProcess")
+	ntResumeProcess  = ntdll.NewProc("NtResumeProcess")
+)
+
+// Pause suspends every thread of the engine process, so it uses no CPU while
+// keeping its state, such as a search in progress and its hash. Unlike on
+// Unix, processes the engine started itself are not suspended
+//
+// A paused engine reads no commands and sends no output, so waits such as
+// WaitReadyOK time out until Resume is called
+func (e *Engine) Pause() error {
+	return e.suspend(ntSuspendProcess)
+}
+
+// Resume continues an engine suspended with Pause
+func (e *Engine) Resume() error {
+	return e.suspend(ntResumeProcess)
+}
+
+// calls NtSuspendProcess or NtResumeProcess on the engine process
+func (e *Engine) suspend(proc *syscall.LazyProc) error {
+	if e.cmd == nil || e.cmd.Process == nil {
+		return errors.New("engine process not started")
+	}
+
+	select {
+	case <-e.exited:
+		return fmt.Errorf("%w: calling %s", ErrEngineExited, proc.Name)
+	default:
+	}
+
+	if err := proc.Find(); err != nil {
+		return fmt.Errorf("%w: %w", errors.ErrUnsupported, err)
+	}
+
+	h, err := syscall.OpenProcess(processSuspendResume, false, uint32(e.cmd.Process.Pid))
+	if err != nil {
+		return fmt.Errorf("opening engine process: %w", err)
+	}
+	defer syscall.CloseHandle(h)
+
+	if status, _, _ := proc.Call(uintptr(h)); status != 0 {
+		return fmt.Errorf("%s failed with status %#x", proc.Name, status)
+	}
+
+	return nil
+}
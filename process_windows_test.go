@@ -0,0 +1,60 @@
+//go:build windows
+
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	eng, _ := newTestEngine()
+	if err := eng.Pause(); err == nil {
+		t.Fatal("expected an error pausing an engine without a process")
+	}
+
+	eng = newMockEngine(t)
+	if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eng.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.WaitReadyOK(100 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a paused engine not to answer, got %v", err)
+	}
+
+	if err := eng.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// an engine that has exited cannot be paused
+	if err := eng.SendQuit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Pause(); !errors.Is(err, ErrEngineExited) {
+		t.Errorf("expected ErrEngineExited, got %v", err)
+	}
+}
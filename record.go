@@ -0,0 +1,52 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+// SetRecordCommands turns recording of the commands sent to the engine on or
+// off. While recording, every command passed to SendCommand, including those
+// sent by higher level methods such as Go or SetOptions, is kept in order
+// and can be read back with RecordedCommands. Commands are still written to
+// the engine
+//
+// Turning recording off keeps the commands already recorded
+func (e *Engine) SetRecordCommands(record bool) {
+	e.stdinMu.Lock()
+	defer e.stdinMu.Unlock()
+
+	e.recording = record
+}
+
+// RecordedCommands returns a copy of the commands recorded since recording
+// was turned on or the recording was last cleared, without trailing newlines
+func (e *Engine) RecordedCommands() []string {
+	e.stdinMu.Lock()
+	defer e.stdinMu.Unlock()
+
+	ret := make([]string, len(e.recorded))
+	copy(ret, e.recorded)
+
+	return ret
+}
+
+// ClearRecordedCommands discards the recorded commands
+func (e *Engine) ClearRecordedCommands() {
+	e.stdinMu.Lock()
+	defer e.stdinMu.Unlock()
+
+	e.recorded = nil
+}
@@ -0,0 +1,94 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordCommands(t *testing.T) {
+	eng, stdin := newOptionsTestEngine(t)
+
+	// nothing is recorded until recording is turned on
+	if err := eng.SendCommand("uci"); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Reset()
+
+	eng.SetRecordCommands(true)
+
+	if err := eng.SetOptions([]EngOption{{Name: "Hash", Value: "64"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SendUCINewGame(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SendStartPos(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.PushMove("e2e4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Go(GoParams{MoveTime: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SendStop(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"setoption name Hash value 64",
+		"isready",
+		"ucinewgame",
+		"position startpos",
+		"position startpos moves e2e4",
+		"go movetime 1000",
+		"stop",
+	}
+
+	recorded := eng.RecordedCommands()
+	if !reflect.DeepEqual(recorded, expected) {
+		t.Fatalf("expected recorded commands %q, got %q", expected, recorded)
+	}
+
+	// the commands are still written to the engine
+	if !reflect.DeepEqual(stdin.Lines(), expected) {
+		t.Fatalf("expected commands %q written to the engine, got %q", expected, stdin.Lines())
+	}
+
+	// the returned slice is a copy
+	recorded[0] = "changed"
+	if eng.RecordedCommands()[0] != expected[0] {
+		t.Fatal("mutating the returned commands changed the recording")
+	}
+
+	eng.SetRecordCommands(false)
+	if err := eng.SendCommand("quit"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(eng.RecordedCommands()); n != len(expected) {
+		t.Fatalf("expected %d recorded commands after stopping, got %d", len(expected), n)
+	}
+
+	eng.ClearRecordedCommands()
+	if n := len(eng.RecordedCommands()); n != 0 {
+		t.Fatalf("expected no recorded commands after clearing, got %d", n)
+	}
+}
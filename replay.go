@@ -0,0 +1,67 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// the longest line ParseLog reads
+	maxLogLineSize = 1 << 20
+)
+
+// ParseLog replays a recorded log of engine output, as written to the
+// engine's stdout, through the parser without starting an engine. It returns
+// the info lines and bestmoves in the order they appear
+//
+// Lines that cannot be parsed are skipped, as they are when reading from an
+// engine, and reported together in the returned error along with their line
+// numbers. An error reading r ends the replay
+func ParseLog(r io.Reader) ([]Info, []BestMove, error) {
+	e := &Engine{}
+	e.stdin = bufio.NewWriter(io.Discard)
+	e.chans.readyOK = make(chan uint64, 1)
+	e.chans.uciOK = make(chan bool, 1)
+	e.chans.bestMove = make(chan searchResult, bestmoveQueueSize)
+	e.queueBestMoves = true
+
+	var bestMoves []BestMove
+	var errs []error
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, defaultLineBufferSize), maxLogLineSize)
+
+	for n := 1; s.Scan(); n++ {
+		if err := e.parseStdout(s.Text()); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", n, err))
+		}
+
+		for len(e.chans.bestMove) > 0 {
+			bestMoves = append(bestMoves, (<-e.chans.bestMove).move)
+		}
+	}
+	if err := s.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return e.infoBuf, bestMoves, errors.Join(errs...)
+}
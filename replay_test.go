@@ -0,0 +1,86 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLog(t *testing.T) {
+	f, err := os.Open("testdata/stockfish.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	info, bestMoves, err := ParseLog(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BestMove{
+		{BestMove: "e2e4", Ponder: "e7e5"},
+		{BestMove: "h5f7"},
+	}
+	if !reflect.DeepEqual(bestMoves, expected) {
+		t.Errorf("expected bestmoves %+v, got %+v", expected, bestMoves)
+	}
+
+	// the info string, 12 lines of the first search and 2 of the second
+	if len(info) != 15 {
+		t.Fatalf("expected 15 info lines, got %d", len(info))
+	}
+	if info[0].String != "NNUE evaluation using nn-5af11540bbfe.nnue enabled" {
+		t.Errorf("unexpected info string %q", info[0].String)
+	}
+
+	deepest := info[12]
+	if deepest.Depth != 10 || deepest.SelDepth != 13 || deepest.Nodes != 34122 ||
+		deepest.HashFull != 13 || deepest.Score.Val != 47 || len(deepest.PV) != 9 {
+		t.Errorf("unexpected deepest line %+v", deepest)
+	}
+	if info[11].CurrMove != "e2e4" || info[11].CurrMoveNumber != 1 {
+		t.Errorf("unexpected currmove line %+v", info[11])
+	}
+	if s := info[14].Score; !s.Mate || s.Val != 1 {
+		t.Errorf("expected mate in 1, got %v", s)
+	}
+}
+
+func TestParseLogErrors(t *testing.T) {
+	log := strings.Join([]string{
+		"info depth 1 score cp 20 pv e2e4",
+		"info depth x score cp 20 pv e2e4",
+		"info depth 2 score cp 25 pv e2e4 e7e5",
+		"bestmove e2e4",
+	}, "\n")
+
+	info, bestMoves, err := ParseLog(strings.NewReader(log))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+	if len(info) != 2 || info[1].Depth != 2 {
+		t.Errorf("expected the other lines to be parsed, got %+v", info)
+	}
+	if len(bestMoves) != 1 {
+		t.Errorf("expected 1 bestmove, got %+v", bestMoves)
+	}
+}
@@ -0,0 +1,639 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the number of info lines buffered for each search
+	searchInfoChanSize = 1024
+)
+
+// GoParams holds the arguments sent with a go command. Fields left at their
+// zero value are not sent to the engine
+//
+// Limits are not exclusive and may be combined, e.g. Depth with MoveTime or
+// Nodes with the clock. All of them are sent in a single go command and the
+// engine ends the search at whichever limit it reaches first, so which one
+// fires is up to the engine
+//
+// A Mate search ends like any other search, with a bestmove, once the engine
+// has found a mate in at most Mate moves or proven there is none. A mate found
+// is reported with a mate score (see WaitForMate); engines that find none
+// usually send their best move anyway, or "(none)"
+type GoParams struct {
+	SearchMoves []string      // restrict the search to these root moves
+	Ponder      bool          // start the search in pondering mode
+	WTime       time.Duration // time white has left on the clock
+	BTime       time.Duration // time black has left on the clock
+	WInc        time.Duration // white increment per move
+	BInc        time.Duration // black increment per move
+	MovesToGo   int           // moves until the next time control
+	Depth       int           // search this many plies only
+	Nodes       int64         // search this many nodes only
+	Mate        int           // search for a mate in this many moves, see below
+	MoveTime    time.Duration // search for exactly this long
+	Infinite    bool          // search until stop is sent
+
+	// NewGame has Analyze and AnalyzeBatch send ucinewgame and wait for the
+	// engine before each position, clearing state such as the hash left over
+	// from an unrelated search. It is not part of the go command
+	NewGame bool
+}
+
+// Validate checks that every search move is in UCI long algebraic notation
+// and is not the null move, that no limit is negative, and that an increment
+// is only given with the time on that side's clock
+func (p GoParams) Validate() error {
+	for _, m := range p.SearchMoves {
+		if m == nullMove {
+			return errors.New("searchmoves: null move cannot be searched")
+		}
+		if _, err := ParseUCIMove(m); err != nil {
+			return fmt.Errorf("searchmoves: %v", err)
+		}
+	}
+
+	for _, d := range []struct {
+		name string
+		val  time.Duration
+	}{
+		{"wtime", p.WTime}, {"btime", p.BTime}, {"winc", p.WInc}, {"binc", p.BInc},
+		{"movetime", p.MoveTime},
+	} {
+		if d.val < 0 {
+			return fmt.Errorf("%s is negative: %v", d.name, d.val)
+		}
+	}
+
+	for _, n := range []struct {
+		name string
+		val  int64
+	}{
+		{"movestogo", int64(p.MovesToGo)}, {"depth", int64(p.Depth)}, {"nodes", p.Nodes},
+		{"mate", int64(p.Mate)},
+	} {
+		if n.val < 0 {
+			return fmt.Errorf("%s is negative: %d", n.name, n.val)
+		}
+	}
+
+	if p.WInc > 0 && p.WTime == 0 {
+		return errors.New("winc given without wtime")
+	}
+	if p.BInc > 0 && p.BTime == 0 {
+		return errors.New("binc given without btime")
+	}
+
+	return nil
+}
+
+// TimeControl is the state of the clocks for a search in a timed game
+type TimeControl struct {
+	WTime     time.Duration // time white has left on the clock
+	BTime     time.Duration // time black has left on the clock
+	WInc      time.Duration // white increment per move
+	BInc      time.Duration // black increment per move
+	MovesToGo int           // moves until the next time control, 0 if none
+}
+
+// Validate checks that the clocks make sense: no value is negative, at least
+// one side has time left, and increments are only given with the time on that
+// side's clock
+func (tc TimeControl) Validate() error {
+	if tc.WTime <= 0 && tc.BTime <= 0 {
+		return errors.New("time control has no time on either clock")
+	}
+
+	return tc.Params().Validate()
+}
+
+// Params returns the go parameters for a search under the time control
+func (tc TimeControl) Params() GoParams {
+	return GoParams{
+		WTime:     tc.WTime,
+		BTime:     tc.BTime,
+		WInc:      tc.WInc,
+		BInc:      tc.BInc,
+		MovesToGo: tc.MovesToGo,
+	}
+}
+
+// String returns the go command described by the parameters
+//
+// searchmoves is always sent last since engines read every remaining token on
+// the line as a move to search
+func (p GoParams) String() string {
+	args := []string{"go"}
+
+	ms := func(d time.Duration) string {
+		return strconv.FormatInt(d.Milliseconds(), 10)
+	}
+
+	if p.Ponder {
+		args = append(args, "ponder")
+	}
+	if p.WTime > 0 {
+		args = append(args, "wtime", ms(p.WTime))
+	}
+	if p.BTime > 0 {
+		args = append(args, "btime", ms(p.BTime))
+	}
+	if p.WInc > 0 {
+		args = append(args, "winc", ms(p.WInc))
+	}
+	if p.BInc > 0 {
+		args = append(args, "binc", ms(p.BInc))
+	}
+	if p.MovesToGo > 0 {
+		args = append(args, "movestogo", strconv.Itoa(p.MovesToGo))
+	}
+	if p.Depth > 0 {
+		args = append(args, "depth", strconv.Itoa(p.Depth))
+	}
+	if p.Nodes > 0 {
+		args = append(args, "nodes", strconv.FormatInt(p.Nodes, 10))
+	}
+	if p.Mate > 0 {
+		args = append(args, "mate", strconv.Itoa(p.Mate))
+	}
+	if p.MoveTime > 0 {
+		args = append(args, "movetime", ms(p.MoveTime))
+	}
+	if p.Infinite {
+		args = append(args, "infinite")
+	}
+	if len(p.SearchMoves) > 0 {
+		args = append(args, "searchmoves")
+		args = append(args, p.SearchMoves...)
+	}
+
+	return strings.Join(args, " ")
+}
+
+// SearchHandle tracks a single search started with StartSearch
+//
+// Info lines sent by the engine during the search are delivered on Info, and
+// the bestmove ending the search on BestMove. Both channels are closed once
+// the search has completed, so Info can be ranged over. If the engine exits
+// or is closed before sending the bestmove, they are closed without one and
+// Err reports why. If Info is not read and its buffer of searchInfoChanSize
+// lines fills, further lines are dropped from the channel (they are still
+// stored in the engine's info buffer)
+type SearchHandle struct {
+	ID       uint64          // unique per engine, increasing with each search
+	Params   GoParams        // the parameters the search was started with
+	Info     <-chan Info     // info lines sent during this search
+	BestMove <-chan BestMove // the bestmove ending this search
+
+	info     chan Info
+	bestMove chan BestMove
+	done     chan struct{}
+	result   BestMove // the bestmove, valid once done is closed
+	err      error    // why the search ended without a bestmove, set before done is closed
+
+	pondering bool // true until ponderhit is sent for a go ponder search
+
+	// the range of info lines, counted over all lines parsed by the engine,
+	// received while this was the current search
+	infoStart uint64
+	infoEnd   uint64
+}
+
+// Done returns a channel that is closed when the search has completed, with a
+// bestmove or because the engine exited
+func (h *SearchHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns an error wrapping ErrEngineExited if the search ended because
+// the engine exited or was closed before sending its bestmove, and nil if the
+// search ended with a bestmove or is still running
+func (h *SearchHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the search to complete and returns its bestmove, or the
+// error reported by Err if the engine exited first
+func (h *SearchHandle) Wait(timeout time.Duration) (BestMove, error) {
+	timer := time.After(timeout)
+
+	select {
+	case <-h.done:
+		return h.result, h.err
+	case <-timer:
+		return BestMove{}, ErrTimeout
+	}
+}
+
+// delivers an info line without blocking the parser
+func (h *SearchHandle) sendInfo(info Info) {
+	select {
+	case h.info <- info:
+	default:
+	}
+}
+
+// completes the search with its bestmove
+func (h *SearchHandle) complete(b BestMove) {
+	h.result = b
+	h.bestMove <- b
+	close(h.bestMove)
+	close(h.info)
+	close(h.done)
+}
+
+// ends the search without a bestmove
+func (h *SearchHandle) fail(err error) {
+	h.err = err
+	close(h.bestMove)
+	close(h.info)
+	close(h.done)
+}
+
+// StartSearch validates the parameters, sends the go command to the engine
+// and returns a handle for the search
+//
+// The info buffer read by GetInfo is cleared when the search starts, so it
+// only holds the lines of the latest search, unless SetKeepInfoHistory has
+// been used to keep them across searches. Likewise a bestmove of an earlier
+// search that was not waited for with WaitBestMove is discarded, unless
+// SetQueueBestMoves is on
+//
+// Only one search may run at a time: an error is returned if a search started
+// with StartSearch or Go has not yet ended with a bestmove, even if it has
+// been stopped. Once the engine has exited, an error wrapping ErrEngineExited
+// is returned. Searches are matched to bestmoves in the order they were
+// started, so commands starting a search must not be sent to the engine with
+// SendCommand while a search is outstanding
+func (e *Engine) StartSearch(p GoParams) (*SearchHandle, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	info := make(chan Info, searchInfoChanSize)
+	bestMove := make(chan BestMove, 1)
+	h := &SearchHandle{
+		Params:   p,
+		Info:     info,
+		BestMove: bestMove,
+		info:     info,
+		bestMove: bestMove,
+		done:     make(chan struct{}),
+	}
+
+	// register the search before sending the command so no output from the
+	// engine can arrive before the search is known
+	e.Lock()
+	if e.outputDone {
+		e.Unlock()
+		return nil, fmt.Errorf("starting search: %w", ErrEngineExited)
+	}
+	if len(e.searches) > 0 {
+		e.Unlock()
+		return nil, ErrSearchInProgress
+	}
+	e.searchID++
+	h.ID = e.searchID
+	if !e.keepInfoHistory {
+		e.infoBuf = nil
+	}
+	if !e.queueBestMoves {
+		// WaitBestMove must not return the result of an earlier search
+		e.drainBestMoves()
+	}
+	h.infoStart = e.infoTotal
+	h.pondering = p.Ponder
+	e.searches = append(e.searches, h)
+	e.Unlock()
+
+	if err := e.SendCommand(p.String()); err != nil {
+		e.Lock()
+		for i, s := range e.searches {
+			if s == h {
+				e.searches = append(e.searches[:i], e.searches[i+1:]...)
+				break
+			}
+		}
+		e.Unlock()
+
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// SearchState describes what the engine is doing
+type SearchState int
+
+const (
+	// Idle means no search is running, so a new search may be started
+	Idle SearchState = iota
+
+	// Searching means a search is running and will end with a bestmove
+	Searching
+
+	// Pondering means a go ponder search is running on the position after
+	// the expected reply. The engine withholds the bestmove until ponderhit
+	// turns it into a normal search, or stop ends it
+	Pondering
+)
+
+func (s SearchState) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Searching:
+		return "searching"
+	case Pondering:
+		return "pondering"
+	}
+
+	return "SearchState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// SearchState returns the state of the search started with StartSearch or
+// Go. The engine is idle once it has sent the bestmove ending the search
+func (e *Engine) SearchState() SearchState {
+	e.RLock()
+	defer e.RUnlock()
+
+	switch {
+	case len(e.searches) == 0:
+		return Idle
+	case e.searches[0].pondering:
+		return Pondering
+	}
+
+	return Searching
+}
+
+// IsSearching returns true from the time a search is started with StartSearch
+// or Go until the engine sends its bestmove, including while pondering
+func (e *Engine) IsSearching() bool {
+	return e.SearchState() != Idle
+}
+
+// SendPonderHit tells the engine that the opponent played the expected move,
+// so the go ponder search continues as a normal search. An error is returned
+// if the engine is not pondering
+//
+// On a ponder miss, send stop instead and wait for the bestmove, which is for
+// the pondered position and should be discarded, before setting up the actual
+// position and starting a new search
+func (e *Engine) SendPonderHit() error {
+	e.RLock()
+	if len(e.searches) == 0 || !e.searches[0].pondering {
+		e.RUnlock()
+		return errors.New("engine is not pondering")
+	}
+	h := e.searches[0]
+	e.RUnlock()
+
+	if err := e.SendCommand("ponderhit"); err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	h.pondering = false
+
+	return nil
+}
+
+// StopAndWait stops the search started with StartSearch or Go and waits up
+// to timeout for the bestmove ending it, after which the engine is idle and a
+// new search may be started. If the search has already ended, nothing is sent
+// and its bestmove is returned straight away
+func (e *Engine) StopAndWait(timeout time.Duration) (BestMove, error) {
+	e.RLock()
+	if len(e.searches) == 0 {
+		b := e.lastBestMove
+		e.RUnlock()
+		return b, nil
+	}
+	h := e.searches[0]
+	e.RUnlock()
+
+	if err := e.SendStop(); err != nil {
+		return BestMove{}, err
+	}
+
+	b, err := h.Wait(timeout)
+	if err != nil {
+		return BestMove{}, fmt.Errorf("waiting for bestmove after stop: %w", err)
+	}
+
+	return b, nil
+}
+
+// Go validates the parameters and sends the go command to the engine. Use
+// StartSearch instead to follow the output of the search
+func (e *Engine) Go(p GoParams) error {
+	_, err := e.StartSearch(p)
+	return err
+}
+
+// GoWithClock validates the time control and starts a search under it, like
+// Go. Use StartSearch with tc.Params() to follow the output of the search
+func (e *Engine) GoWithClock(tc TimeControl) error {
+	if err := tc.Validate(); err != nil {
+		return err
+	}
+
+	return e.Go(tc.Params())
+}
+
+// BestMoveForFEN searches the position given by fen from a clean state and
+// returns the bestmove. It sends ucinewgame, waits for the engine to be
+// ready, sends the position and starts the search with the given parameters
+//
+// If the search has not ended within timeout it is stopped, and the bestmove
+// the engine sends in response is returned along with an error
+func (e *Engine) BestMoveForFEN(fen string, p GoParams, timeout time.Duration) (BestMove, error) {
+	if err := p.Validate(); err != nil {
+		return BestMove{}, err
+	}
+
+	if err := e.SendUCINewGame(); err != nil {
+		return BestMove{}, err
+	}
+	if err := e.WaitReadyOK(defaultReadyTimeout); err != nil {
+		return BestMove{}, err
+	}
+	if err := e.SendFENChecked(fen); err != nil {
+		return BestMove{}, err
+	}
+
+	h, err := e.StartSearch(p)
+	if err != nil {
+		return BestMove{}, err
+	}
+
+	b, err := h.Wait(timeout)
+	if err == nil {
+		return b, nil
+	}
+
+	if err = e.SendStop(); err != nil {
+		return BestMove{}, err
+	}
+	if b, err = h.Wait(defaultReadyTimeout); err != nil {
+		return BestMove{}, fmt.Errorf("waiting for bestmove after stop: %w", err)
+	}
+
+	return b, fmt.Errorf("search stopped: %w", ErrTimeout)
+}
+
+// Analyze sets up the position and starts a search, returning channels that
+// stream the info lines of the search and deliver its bestmove. pos is a FEN,
+// or "startpos" (or empty) for the standard starting position
+//
+// Both channels are closed once the bestmove has been delivered. If ctx is
+// cancelled before then, stop is sent to the engine; the engine still ends
+// the search with a bestmove, which is delivered as normal. If the engine
+// exits or is closed during the search, both channels are closed without a
+// bestmove and the error is logged; use StartSearch to get it from
+// SearchHandle.Err. Info lines are dropped if the info channel is not read and
+// its buffer of searchInfoChanSize lines fills
+//
+// If p.NewGame is set, ucinewgame is sent and the engine is waited for before
+// the position is set up
+func (e *Engine) Analyze(ctx context.Context, pos string, p GoParams) (<-chan Info, <-chan BestMove, error) {
+	h, err := e.analyze(ctx, pos, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h.Info, h.BestMove, nil
+}
+
+// sets up the position and starts a search as Analyze does, returning its
+// handle. Stop is sent to the engine if ctx is cancelled during the search
+func (e *Engine) analyze(ctx context.Context, pos string, p GoParams) (*SearchHandle, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if p.NewGame {
+		if err := e.SendUCINewGame(); err != nil {
+			return nil, err
+		}
+		if err := e.WaitReadyOK(defaultReadyTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if pos == "" || pos == "startpos" {
+		err = e.SendStartPos()
+	} else {
+		err = e.SendFENChecked(pos)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := e.StartSearch(p)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := e.SendStop(); err != nil {
+				e.log().Error("stopping cancelled analysis", "err", err)
+			}
+		case <-h.Done():
+			if err := h.Err(); err != nil {
+				e.log().Error("analysis ended without a bestmove", "err", err)
+			}
+		}
+	}()
+
+	return h, nil
+}
+
+// AnalyzeBatch searches each position in fens in turn with the given
+// parameters and returns their bestmoves in order. Set p.NewGame for each
+// search to start from a clean state, with ucinewgame sent and the engine
+// waited for before the position is set up
+//
+// If ctx is cancelled, no further positions are searched and a running search
+// is stopped. The bestmoves of the positions completed so far are returned
+// along with the context's error. The engine is given up to 5 seconds to end
+// the stopped search with a bestmove, after which it may still be searching
+//
+// If the engine exits, the bestmoves of the positions completed so far are
+// returned along with an error wrapping ErrEngineExited
+func (e *Engine) AnalyzeBatch(ctx context.Context, fens []string, p GoParams) ([]BestMove, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]BestMove, 0, len(fens))
+
+	for i, fen := range fens {
+		if err := ctx.Err(); err != nil {
+			return ret, err
+		}
+
+		h, err := e.analyze(ctx, fen, p)
+		if err != nil {
+			return ret, fmt.Errorf("position %d: %w", i, err)
+		}
+
+		// the search ends with a bestmove or the engine exiting
+		select {
+		case <-h.Done():
+		case <-ctx.Done():
+			// stop has been sent, wait a while for the engine to be idle
+			select {
+			case <-h.Done():
+			case <-time.After(defaultReadyTimeout):
+			}
+		}
+
+		// a stopped search has not found the bestmove it was asked for
+		if err := ctx.Err(); err != nil {
+			return ret, err
+		}
+
+		if err := h.Err(); err != nil {
+			return ret, fmt.Errorf("position %d: %w", i, err)
+		}
+
+		ret = append(ret, h.result)
+	}
+
+	return ret, nil
+}
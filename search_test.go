@@ -0,0 +1,873 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGoParamsString(t *testing.T) {
+	tt := []struct {
+		name   string
+		params GoParams
+		output string
+	}{
+		{
+			name:   "empty",
+			params: GoParams{},
+			output: "go",
+		},
+		{
+			name:   "searchmoves only",
+			params: GoParams{SearchMoves: []string{"e2e4", "d2d4"}},
+			output: "go searchmoves e2e4 d2d4",
+		},
+		{
+			name: "searchmoves after other subcommands",
+			params: GoParams{
+				SearchMoves: []string{"e2e4", "g1f3"},
+				Depth:       12,
+				MoveTime:    2 * time.Second,
+			},
+			output: "go depth 12 movetime 2000 searchmoves e2e4 g1f3",
+		},
+		{
+			name: "searchmoves with infinite",
+			params: GoParams{
+				SearchMoves: []string{"e7e8q"},
+				Infinite:    true,
+			},
+			output: "go infinite searchmoves e7e8q",
+		},
+		{
+			name:   "mate",
+			params: GoParams{Mate: 3},
+			output: "go mate 3",
+		},
+		{
+			name:   "depth and movetime",
+			params: GoParams{Depth: 30, MoveTime: 5 * time.Second},
+			output: "go depth 30 movetime 5000",
+		},
+		{
+			name:   "depth, nodes and mate",
+			params: GoParams{Depth: 20, Nodes: 1000000, Mate: 3},
+			output: "go depth 20 nodes 1000000 mate 3",
+		},
+		{
+			name: "clock with depth and nodes",
+			params: GoParams{
+				WTime:     time.Minute,
+				BTime:     50 * time.Second,
+				WInc:      time.Second,
+				BInc:      time.Second,
+				MovesToGo: 20,
+				Depth:     18,
+				Nodes:     500000,
+			},
+			output: "go wtime 60000 btime 50000 winc 1000 binc 1000 movestogo 20 depth 18 nodes 500000",
+		},
+		{
+			name:   "nodes beyond 32 bits",
+			params: GoParams{Nodes: 10_000_000_000},
+			output: "go nodes 10000000000",
+		},
+		{
+			name: "every limit",
+			params: GoParams{
+				Depth:    12,
+				Nodes:    300,
+				Mate:     2,
+				MoveTime: 250 * time.Millisecond,
+			},
+			output: "go depth 12 nodes 300 mate 2 movetime 250",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.params.Validate(); err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+
+			if s := tc.params.String(); s != tc.output {
+				t.Fatalf("expected %q, got %q", tc.output, s)
+			}
+		})
+	}
+}
+
+func TestGoParamsValidate(t *testing.T) {
+	bad := [][]string{
+		{"e2e9"},
+		{"e2-e4"},
+		{"Nf3"},
+		{"e2e4", "e7e8k"},
+		{""},
+		{"0000"},
+		{"e2e4", "0000"},
+	}
+
+	for _, moves := range bad {
+		p := GoParams{SearchMoves: moves}
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error for searchmoves %q", moves)
+		}
+	}
+
+	badParams := []GoParams{
+		{WTime: -time.Second},
+		{BTime: time.Minute, BInc: -time.Second},
+		{MoveTime: -1},
+		{Depth: -1},
+		{Nodes: -100},
+		{Mate: -2},
+		{WTime: time.Minute, MovesToGo: -1},
+		{WInc: time.Second},
+		{WTime: time.Minute, BInc: time.Second},
+	}
+
+	for _, p := range badParams {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+}
+
+func TestGoWithClock(t *testing.T) {
+	eng, buf := newTestEngine()
+
+	// 3+2 blitz, 40 moves in
+	tc := TimeControl{
+		WTime: 95500 * time.Millisecond,
+		BTime: 101 * time.Second,
+		WInc:  2 * time.Second,
+		BInc:  2 * time.Second,
+	}
+	if err := eng.GoWithClock(tc); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "go wtime 95500 btime 101000 winc 2000 binc 2000\n" {
+		t.Fatalf("unexpected command %q", buf.String())
+	}
+	feedLines(t, eng, "bestmove e2e4")
+
+	// classical with moves to go, and no increment
+	buf.Reset()
+	tc = TimeControl{WTime: 30 * time.Minute, BTime: 28 * time.Minute, MovesToGo: 12}
+	if err := eng.GoWithClock(tc); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "go wtime 1800000 btime 1680000 movestogo 12\n" {
+		t.Fatalf("unexpected command %q", buf.String())
+	}
+	feedLines(t, eng, "bestmove e2e4")
+
+	buf.Reset()
+	for _, tc := range []TimeControl{
+		{},
+		{WInc: time.Second, BInc: time.Second},
+		{WTime: -time.Second, BTime: time.Minute},
+		{WTime: time.Minute, BTime: time.Minute, BInc: -time.Second},
+	} {
+		if err := eng.GoWithClock(tc); err == nil {
+			t.Errorf("expected error for %+v", tc)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be sent, got %q", buf.String())
+	}
+}
+
+func TestGoSendsSearchMoves(t *testing.T) {
+	eng, buf := newTestEngine()
+
+	err := eng.Go(GoParams{Depth: 5, SearchMoves: []string{"e2e4", "d2d4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "go depth 5 searchmoves e2e4 d2d4\n" {
+		t.Fatalf("unexpected command %q", buf.String())
+	}
+
+	buf.Reset()
+	if err = eng.Go(GoParams{SearchMoves: []string{"e4"}}); err == nil {
+		t.Fatal("expected invalid move to be rejected")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("invalid go command should not be sent, got %q", buf.String())
+	}
+}
+
+func TestStartSearch(t *testing.T) {
+	eng := newMockEngine(t)
+
+	var prev uint64
+	for _, move := range []string{"d2d4", "g1f3"} {
+		h, err := eng.StartSearch(GoParams{Depth: 2, SearchMoves: []string{move}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.ID == prev {
+			t.Fatalf("expected distinct search ids, both are %d", h.ID)
+		}
+		prev = h.ID
+
+		var info []Info
+		for i := range h.Info {
+			info = append(info, i)
+		}
+
+		if len(info) != 2 {
+			t.Fatalf("search %d: expected 2 info lines, got %d", h.ID, len(info))
+		}
+		for _, i := range info {
+			if i.PV[0] != move {
+				t.Errorf("search %d: info line %q belongs to another search", h.ID, i.Raw)
+			}
+		}
+
+		b := <-h.BestMove
+		if b.BestMove != move {
+			t.Fatalf("search %d: expected bestmove %s, got %s", h.ID, move, b.BestMove)
+		}
+
+		b, err = h.Wait(time.Second)
+		if err != nil || b.BestMove != move {
+			t.Fatalf("search %d: Wait returned %v, %v", h.ID, b, err)
+		}
+	}
+}
+
+func TestIsSearching(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	if eng.IsSearching() {
+		t.Fatal("expected a new engine to be idle")
+	}
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !eng.IsSearching() {
+		t.Fatal("expected the engine to be searching after go")
+	}
+
+	// go is not allowed while searching
+	if err := eng.Go(GoParams{Depth: 5}); err == nil {
+		t.Fatal("expected an error starting a second search")
+	}
+
+	// the search only ends with the bestmove, not with stop
+	if err := eng.SendStop(); err != nil {
+		t.Fatal(err)
+	}
+	if !eng.IsSearching() {
+		t.Fatal("expected the engine to be searching until the bestmove")
+	}
+
+	feedLines(t, eng, "info depth 1 score cp 10 pv e2e4", "bestmove e2e4")
+	if eng.IsSearching() {
+		t.Fatal("expected the engine to be idle after the bestmove")
+	}
+
+	if err := eng.Go(GoParams{Depth: 5}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchEngineExited(t *testing.T) {
+	// the engine crashes partway through the search
+	eng := newMockEngine(t, "partial:info depth 3")
+
+	h, err := eng.StartSearch(GoParams{Depth: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var depths []int
+	for i := range h.Info {
+		depths = append(depths, i.Depth)
+	}
+	if !reflect.DeepEqual(depths, []int{1, 2, 3}) {
+		t.Fatalf("expected info lines at depths 1 to 3, got %v", depths)
+	}
+
+	if b, ok := <-h.BestMove; ok {
+		t.Fatalf("expected no bestmove, got %+v", b)
+	}
+	if _, err = h.Wait(time.Second); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited, got %v", err)
+	}
+	if !errors.Is(h.Err(), ErrEngineExited) {
+		t.Fatalf("expected Err to report ErrEngineExited, got %v", h.Err())
+	}
+
+	if eng.IsSearching() {
+		t.Fatal("expected the engine to be idle once it has exited")
+	}
+	if _, err = eng.StartSearch(GoParams{Depth: 5}); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited starting a search, got %v", err)
+	}
+
+	// waiters following the search when the output ends return
+	eng, _ = newTestEngine()
+	if err = eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	seq := make(chan []int)
+	go func() {
+		var depths []int
+		for i := range eng.InfoSeq(context.Background()) {
+			depths = append(depths, i.Depth)
+		}
+		seq <- depths
+	}()
+
+	for {
+		eng.RLock()
+		n := len(eng.subscribers)
+		eng.RUnlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	sendLines(eng, "info depth 1 score cp 10 pv e2e4")
+	close(eng.stdout)
+
+	select {
+	case depths := <-seq:
+		if !reflect.DeepEqual(depths, []int{1}) {
+			t.Fatalf("expected the info line at depth 1, got %v", depths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected InfoSeq to end once the output ended")
+	}
+}
+
+func TestBestMoveForFEN(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+	eng := newMockEngine(t)
+	eng.SetRecordCommands(true)
+
+	b, err := eng.BestMoveForFEN(fen, GoParams{Depth: 2}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "e2e4" || b.Ponder != "e7e5" {
+		t.Fatalf("expected bestmove e2e4 ponder e7e5, got %+v", b)
+	}
+
+	expected := []string{"ucinewgame", "isready", "position fen " + fen, "go depth 2"}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("expected commands %q, got %q", expected, cmds)
+	}
+
+	// a search still running at the timeout is stopped
+	b, err = eng.BestMoveForFEN(fen, GoParams{Infinite: true}, 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if b.BestMove != "e2e4" {
+		t.Fatalf("expected the bestmove sent after stop, got %+v", b)
+	}
+	if eng.IsSearching() {
+		t.Fatal("expected the engine to be idle")
+	}
+
+	if _, err = eng.BestMoveForFEN("not a fen", GoParams{Depth: 2}, time.Second); err == nil {
+		t.Fatal("expected an error for an invalid FEN")
+	}
+}
+
+func TestPonderHit(t *testing.T) {
+	eng := newMockEngine(t)
+
+	if err := eng.SendPonderHit(); err == nil {
+		t.Fatal("expected an error sending ponderhit while idle")
+	}
+
+	h, err := eng.StartSearch(GoParams{Ponder: true, WTime: time.Minute, BTime: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := eng.SearchState(); state != Pondering {
+		t.Fatalf("expected state pondering, got %v", state)
+	}
+
+	// the bestmove is withheld while pondering
+	if _, err = h.Wait(50 * time.Millisecond); err == nil {
+		t.Fatal("expected no bestmove while pondering")
+	}
+
+	if err = eng.SendPonderHit(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := eng.WaitBestMove(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "e2e4" {
+		t.Fatalf("expected bestmove e2e4, got %+v", b)
+	}
+
+	<-h.Done()
+	if state := eng.SearchState(); state != Idle {
+		t.Fatalf("expected state idle, got %v", state)
+	}
+}
+
+func TestPonderMiss(t *testing.T) {
+	eng := newMockEngine(t)
+
+	if err := eng.Go(GoParams{Ponder: true, Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if state := eng.SearchState(); state != Pondering {
+		t.Fatalf("expected state pondering, got %v", state)
+	}
+
+	// the opponent played another move: stop, and discard the bestmove
+	if err := eng.SendStop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SendPonderHit(); err == nil {
+		t.Fatal("expected an error sending ponderhit after the search ended")
+	}
+
+	h, err := eng.StartSearch(GoParams{Depth: 2, SearchMoves: []string{"d2d4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := eng.SearchState(); state == Pondering {
+		t.Fatal("expected the new search not to be pondering")
+	}
+
+	b, err := h.Wait(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "d2d4" {
+		t.Fatalf("expected bestmove d2d4, got %+v", b)
+	}
+}
+
+func TestInfoClearedPerSearch(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	search := func(move string) {
+		t.Helper()
+
+		if err := eng.Go(GoParams{Depth: 2}); err != nil {
+			t.Fatal(err)
+		}
+		feedLines(t, eng,
+			"info depth 1 score cp 10 pv "+move,
+			"info depth 2 score cp 12 pv "+move,
+			"bestmove "+move,
+		)
+	}
+
+	search("e2e4")
+	search("d2d4")
+
+	info := eng.GetInfo(-1)
+	if len(info) != 2 {
+		t.Fatalf("expected the 2 lines of the latest search, got %d", len(info))
+	}
+	for _, i := range info {
+		if i.PV[0] != "d2d4" {
+			t.Errorf("info line %q is from an earlier search", i.Raw)
+		}
+	}
+
+	// opting out keeps the lines of every search
+	eng.SetKeepInfoHistory(true)
+	search("g1f3")
+
+	info = eng.GetInfo(-1)
+	if len(info) != 4 {
+		t.Fatalf("expected the lines of both searches, got %d", len(info))
+	}
+	if info[0].PV[0] != "d2d4" || info[3].PV[0] != "g1f3" {
+		t.Errorf("unexpected info history %q, %q", info[0].Raw, info[3].Raw)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	eng := newMockEngine(t)
+	eng.SetRecordCommands(true)
+
+	info, bestMove, err := eng.Analyze(context.Background(), "startpos", GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var depths []int
+	for i := range info {
+		depths = append(depths, i.Depth)
+	}
+	if !reflect.DeepEqual(depths, []int{1, 2}) {
+		t.Fatalf("expected info lines at depths 1 and 2, got %v", depths)
+	}
+
+	b, ok := <-bestMove
+	if !ok || b.BestMove != "e2e4" {
+		t.Fatalf("expected bestmove e2e4, got %+v", b)
+	}
+	if _, ok = <-bestMove; ok {
+		t.Fatal("expected the bestmove channel to be closed")
+	}
+
+	expected := []string{"position startpos", "go depth 2"}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("expected commands %q, got %q", expected, cmds)
+	}
+}
+
+func TestAnalyzeCancel(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+
+	eng := newMockEngine(t)
+	eng.SetRecordCommands(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info, bestMove, err := eng.Analyze(ctx, fen, GoParams{Infinite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the infinite search only ends once cancelled
+	<-info
+	select {
+	case b := <-bestMove:
+		t.Fatalf("unexpected bestmove %+v before cancelling", b)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+
+	select {
+	case b := <-bestMove:
+		if b.BestMove != "e2e4" {
+			t.Fatalf("expected bestmove e2e4, got %+v", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no bestmove after cancelling")
+	}
+
+	expected := []string{"position fen " + fen, "go infinite", "stop"}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("expected commands %q, got %q", expected, cmds)
+	}
+}
+
+func TestAnalyzeEngineExited(t *testing.T) {
+	eng := newMockEngine(t, "partial:info depth 3")
+
+	info, bestMove, err := eng.Analyze(context.Background(), "startpos", GoParams{Depth: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range info {
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the info channel to be closed once the engine exited")
+	}
+	if b, ok := <-bestMove; ok {
+		t.Fatalf("expected the bestmove channel to be closed without a bestmove, got %+v", b)
+	}
+
+	if _, _, err = eng.Analyze(context.Background(), "startpos", GoParams{Depth: 5}); err == nil {
+		t.Fatal("expected an error analyzing with an engine that has exited")
+	}
+}
+
+func TestAnalyzeBatch(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2",
+	}
+	moves := []string{"c7c5", "g1f3", "b8c6"}
+
+	var args []string
+	for i, fen := range fens {
+		args = append(args, "move:"+fen+"="+moves[i])
+	}
+	eng := newMockEngine(t, args...)
+
+	results, err := eng.AnalyzeBatch(context.Background(), fens, GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(fens) {
+		t.Fatalf("expected %d results, got %d", len(fens), len(results))
+	}
+	for i, b := range results {
+		if b.BestMove != moves[i] {
+			t.Errorf("position %d: expected %s, got %s", i, moves[i], b.BestMove)
+		}
+	}
+
+	// a cancelled context stops the batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err = eng.AnalyzeBatch(ctx, fens, GoParams{Depth: 2})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no results, got %+v", results)
+	}
+
+	// cancelling during a search stops it
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	results, err = eng.AnalyzeBatch(ctx, fens, GoParams{Infinite: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no results, got %+v", results)
+	}
+	if eng.IsSearching() {
+		t.Fatal("expected the search to be stopped")
+	}
+
+	// an engine that crashes during a position ends the batch
+	crashing := newMockEngine(t, "partial:info depth 3")
+
+	results, err = crashing.AnalyzeBatch(context.Background(), fens, GoParams{Depth: 5})
+	if !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no results, got %+v", results)
+	}
+
+	// and so does an engine closed once the context is cancelled
+	stuck, _ := newTestEngine()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		stuck.Close()
+	}()
+	results, err = stuck.AnalyzeBatch(ctx, fens, GoParams{Infinite: true})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestAnalyzeNewGame(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+	}
+
+	eng := newMockEngine(t)
+	eng.SetRecordCommands(true)
+
+	if _, err := eng.AnalyzeBatch(context.Background(), fens, GoParams{Depth: 2, NewGame: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"ucinewgame", "isready", "position fen " + fens[0], "go depth 2",
+		"ucinewgame", "isready", "position fen " + fens[1], "go depth 2",
+	}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %q, got %q", expected, cmds)
+	}
+
+	eng.ClearRecordedCommands()
+	if _, err := eng.AnalyzeBatch(context.Background(), fens, GoParams{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{
+		"position fen " + fens[0], "go depth 2",
+		"position fen " + fens[1], "go depth 2",
+	}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %q, got %q", expected, cmds)
+	}
+
+	// NewGame is not part of the go command
+	if s := (GoParams{Depth: 2, NewGame: true}).String(); s != "go depth 2" {
+		t.Errorf("unexpected go command %q", s)
+	}
+}
+
+func TestStopAndWait(t *testing.T) {
+	eng := newMockEngine(t)
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := eng.StopAndWait(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "e2e4" {
+		t.Errorf("expected e2e4, got %+v", b)
+	}
+	if eng.IsSearching() {
+		t.Fatal("expected the engine to be idle")
+	}
+
+	// a search that has already ended
+	h, err := eng.StartSearch(GoParams{Depth: 2, SearchMoves: []string{"d2d4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.Wait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	eng.SetRecordCommands(true)
+	if b, err = eng.StopAndWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "d2d4" {
+		t.Errorf("expected d2d4, got %+v", b)
+	}
+	if cmds := eng.RecordedCommands(); len(cmds) != 0 {
+		t.Errorf("expected nothing to be sent, got %q", cmds)
+	}
+
+	// an engine that never answers
+	stuck, _ := newTestEngine()
+	if err = stuck.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stuck.StopAndWait(50 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestWaitBestMoveAfterHandleSearch(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+	eng := newMockEngine(t)
+
+	// the bestmove of a search followed through its handle is not waited for
+	b, err := eng.BestMoveForFEN(fen, GoParams{Depth: 2}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "e2e4" {
+		t.Fatalf("expected e2e4, got %+v", b)
+	}
+
+	if err = eng.Go(GoParams{Depth: 2, SearchMoves: []string{"d2d4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "d2d4" {
+		t.Fatalf("expected the bestmove of the latest search d2d4, got %+v", b)
+	}
+
+	// queued bestmoves are kept across searches
+	eng.SetQueueBestMoves(true)
+	for _, move := range []string{"g1f3", "c2c4"} {
+		h, err := eng.StartSearch(GoParams{Depth: 2, SearchMoves: []string{move}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = h.Wait(5 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, move := range []string{"g1f3", "c2c4"} {
+		if b, err = eng.WaitBestMove(5 * time.Second); err != nil || b.BestMove != move {
+			t.Fatalf("expected queued bestmove %s, got %+v, %v", move, b, err)
+		}
+	}
+}
+
+func TestGoMate(t *testing.T) {
+	const fen = "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4"
+
+	eng := newMockEngine(t, "move:"+fen+"=h5f7;mate 1")
+	eng.SetRecordCommands(true)
+
+	if err := eng.SendFEN(fen); err != nil {
+		t.Fatal(err)
+	}
+	h, err := eng.StartSearch(GoParams{Mate: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := h.Wait(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "h5f7" {
+		t.Errorf("expected h5f7, got %+v", b)
+	}
+
+	// the search is over, and the mate is in its info lines
+	if eng.IsSearching() {
+		t.Error("expected the mate search to have ended")
+	}
+	info, err := eng.WaitForMate(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves, favorable, _ := info.Score.MateIn(); moves != 1 || !favorable {
+		t.Errorf("expected mate in 1, got %v", info.Score)
+	}
+
+	expected := []string{"position fen " + fen, "go mate 3"}
+	if cmds := eng.RecordedCommands(); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %q, got %q", expected, cmds)
+	}
+}
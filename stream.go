@@ -23,6 +23,8 @@ package uci
 import (
 	"bytes"
 	"fmt"
+	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -45,15 +47,32 @@ func (e ErrLineBufferOverflow) Error() string {
 		len(e.Line)-e.BufferSize, e.BufferSize)
 }
 
+// OverflowPolicy decides what an OutputStream does with a line when its
+// channel is full
+type OverflowPolicy int
+
+const (
+	// Block waits until there is room in the channel. No lines are lost, but
+	// reading from the engine stalls while the channel is full
+	Block OverflowPolicy = iota
+
+	// DropOldest discards the oldest line in the channel to make room
+	DropOldest
+
+	// DropNewest discards the line that does not fit
+	DropNewest
+)
+
 // OutputStream represents real time, line by line output from a running Cmd.
 // Lines are terminated by a single newline preceded by an optional carriage
 // return. Both newline and carriage return are stripped from the line when
 // sent to a caller-provided channel.
 //
 // The caller must begin receiving before starting the Cmd. This is done by the
-// internal engine output parsing routines. Write blocks on the channel; the
-// caller must always read the channel. The channel is not closed by the
-// OutputStream.
+// internal engine output parsing routines. By default Write blocks on the
+// channel; the caller must always read the channel. With an OverflowPolicy
+// that drops lines Write never blocks, and the lines dropped are counted. The
+// channel is not closed by the OutputStream.
 //
 // While runnableCmd is running, lines are sent to the channel as soon as they
 // are written and newline-terminated by the command. After the command finishes,
@@ -65,32 +84,166 @@ func (e ErrLineBufferOverflow) Error() string {
 //
 // Since the channel is not closed by the OutputStream, the two indications that
 // all lines have been sent and received are the command finishing and the
-// channel size being zero.
+// channel size being zero. If the command may exit without terminating its
+// last line, call Flush once it has finished to send that line too.
 type OutputStream struct {
 	streamChan chan string
 	bufSize    int
 	buf        []byte
 	lastChar   int
+	policy     OverflowPolicy
+	dropped    atomic.Uint64
+	lines      atomic.Int64 // lines emitted on the channel
+	lineLimit  int          // max lines to emit, 0 for no limit
+	splitCR    bool         // a lone carriage return also ends a line
+	pendingCR  bool         // the last write ended with a carriage return
+	mu         sync.Mutex   // guards the line buffer and limit
 }
 
 // NewOutputStream creates a new streaming output on the given channel. The
 // caller must begin receiving on the channel before the command is started.
 // The OutputStream never closes the channel.
 func NewOutputStream(streamChan chan string, lineBufSize int) *OutputStream {
+	return NewOutputStreamWithPolicy(streamChan, lineBufSize, Block)
+}
+
+// NewOutputStreamWithPolicy creates a new streaming output on the given
+// channel, handling a full channel according to policy
+func NewOutputStreamWithPolicy(streamChan chan string, lineBufSize int,
+	policy OverflowPolicy) *OutputStream {
+
 	out := &OutputStream{
 		streamChan: streamChan,
 		bufSize:    lineBufSize,
 		buf:        make([]byte, lineBufSize),
 		lastChar:   0,
+		policy:     policy,
 	}
 	return out
 }
 
+// Dropped returns the number of lines discarded because the channel was full
+// or the line limit had been reached
+func (rw *OutputStream) Dropped() uint64 {
+	return rw.dropped.Load()
+}
+
+// Lines returns the number of lines emitted on the channel since the
+// OutputStream was created or last reset. Lines dropped because the channel
+// was full are included
+func (rw *OutputStream) Lines() int {
+	return int(rw.lines.Load())
+}
+
+// SetLineLimit guards against a runaway command by limiting the number of
+// lines emitted to n. Once Lines reaches n, further lines are discarded and
+// counted as dropped. A limit of 0 (the default) means no limit
+func (rw *OutputStream) SetLineLimit(n int) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.lineLimit = n
+}
+
+// SetSplitCarriageReturns makes a carriage return that is not followed by a
+// newline end a line too, so output that redraws a status line in place
+// (e.g. a progress bar) is sent as a line per update instead of accumulating
+// in the line buffer. It is off by default
+func (rw *OutputStream) SetSplitCarriageReturns(split bool) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.splitCR = split
+}
+
+// Reset discards any buffered partial line and resets the line count
+func (rw *OutputStream) Reset() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.lastChar = 0
+	rw.pendingCR = false
+	rw.lines.Store(0)
+}
+
+// Flush emits the buffered partial line, if any, as a complete line. This is
+// useful when the command exits without terminating its last line
+func (rw *OutputStream) Flush() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.lastChar == 0 && !rw.pendingCR {
+		return
+	}
+
+	line := string(rw.buf[0:rw.lastChar])
+	rw.lastChar = 0
+	rw.pendingCR = false
+	rw.emit(line)
+}
+
+// emits a line unless the line limit has been reached. The caller must hold
+// the mutex
+func (rw *OutputStream) emit(line string) {
+	if rw.lineLimit > 0 && rw.lines.Load() >= int64(rw.lineLimit) {
+		rw.dropped.Add(1)
+		return
+	}
+
+	rw.lines.Add(1)
+	rw.send(line)
+}
+
+// sends a line on the channel according to the overflow policy
+func (rw *OutputStream) send(line string) {
+	switch rw.policy {
+	case DropNewest:
+		select {
+		case rw.streamChan <- line:
+		default:
+			rw.dropped.Add(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case rw.streamChan <- line:
+				return
+			default:
+			}
+
+			// the receiver may have made room in the meantime
+			select {
+			case <-rw.streamChan:
+				rw.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		rw.streamChan <- line // blocks if chan full
+	}
+}
+
 // Write makes OutputStream implement the io.Writer interface. Do not call
 // this function directly.
 func (rw *OutputStream) Write(p []byte) (n int, err error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
 	n = len(p) // end of buffer
 	firstChar := 0
+	rest := n // end of the bytes left to buffer after the last line
+
+	// A carriage return ending the last write could not be told apart from
+	// the start of "\r\n" then. Unless this write starts with the newline, it
+	// ended the buffered line
+	if rw.pendingCR && n > 0 {
+		rw.pendingCR = false
+		if p[0] != '\n' {
+			line := string(rw.buf[0:rw.lastChar])
+			rw.lastChar = 0
+			rw.emit(line)
+		}
+	}
 
 LINES:
 	for {
@@ -99,6 +252,32 @@ LINES:
 		// will be 0 ("foo\nbar\n") then 4 ("bar\n") on next iteration. And i
 		// will be 3 and 7, respectively. So lines are [0:3] are [4:7].
 		newlineOffset := bytes.IndexByte(p[firstChar:], '\n')
+
+		// In split mode a carriage return before the newline, and not right
+		// before it, ends a line of its own: "line\rline\r"
+		if rw.splitCR {
+			cr := bytes.IndexByte(p[firstChar:], '\r')
+			if cr >= 0 && (newlineOffset < 0 || cr < newlineOffset-1) {
+				if firstChar+cr+1 == n {
+					// the last byte, so it may be the start of "\r\n"
+					rest = firstChar + cr
+					rw.pendingCR = true
+					break LINES
+				}
+
+				var line string
+				if rw.lastChar > 0 {
+					line = string(rw.buf[0:rw.lastChar])
+					rw.lastChar = 0
+				}
+				line += string(p[firstChar : firstChar+cr])
+				rw.emit(line)
+
+				firstChar += cr + 1
+				continue
+			}
+		}
+
 		if newlineOffset < 0 {
 			break LINES // no newline in stream, next line incomplete
 		}
@@ -106,7 +285,7 @@ LINES:
 		// End of line offset is start (nextLine) + newline offset. Like bufio.Scanner,
 		// we allow \r\n but strip the \r too by decrementing the offset for that byte.
 		lastChar := firstChar + newlineOffset // "line\n"
-		if newlineOffset > 0 && p[newlineOffset-1] == '\r' {
+		if newlineOffset > 0 && p[firstChar+newlineOffset-1] == '\r' {
 			lastChar-- // "line\r\n"
 		}
 
@@ -117,21 +296,22 @@ LINES:
 			rw.lastChar = 0 // reset buffer
 		}
 		line += string(p[firstChar:lastChar])
-		rw.streamChan <- line // blocks if chan full
+		rw.emit(line)
 
 		// Next line offset is the first byte (+1) after the newline (i)
 		firstChar += newlineOffset + 1
 	}
 
-	if firstChar < n {
-		remain := len(p[firstChar:])
+	if firstChar < rest {
+		remain := len(p[firstChar:rest])
 		bufFree := len(rw.buf[rw.lastChar:])
 		if remain > bufFree {
+			rw.pendingCR = false
 			var line string
 			if rw.lastChar > 0 {
 				line = string(rw.buf[0:rw.lastChar])
 			}
-			line += string(p[firstChar:])
+			line += string(p[firstChar:rest])
 			err = ErrLineBufferOverflow{
 				Line:       line,
 				BufferSize: rw.bufSize,
@@ -140,7 +320,7 @@ LINES:
 			n = firstChar
 			return // implicit
 		}
-		copy(rw.buf[rw.lastChar:], p[firstChar:])
+		copy(rw.buf[rw.lastChar:], p[firstChar:rest])
 		rw.lastChar += remain
 	}
 
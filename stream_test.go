@@ -0,0 +1,245 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// returns the lines waiting in the channel
+func drain(ch chan string) []string {
+	var lines []string
+	for len(ch) > 0 {
+		lines = append(lines, <-ch)
+	}
+	return lines
+}
+
+func TestOutputStreamOverflow(t *testing.T) {
+	const output = "one\ntwo\nthree\nfour\nfive\n"
+
+	tt := []struct {
+		name    string
+		policy  OverflowPolicy
+		lines   []string
+		dropped uint64
+	}{
+		{name: "drop oldest", policy: DropOldest, lines: []string{"four", "five"}, dropped: 3},
+		{name: "drop newest", policy: DropNewest, lines: []string{"one", "two"}, dropped: 3},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// a consumer that reads nothing until the output is written
+			ch := make(chan string, 2)
+			out := NewOutputStreamWithPolicy(ch, defaultLineBufferSize, tc.policy)
+
+			n, err := out.Write([]byte(output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(output) {
+				t.Fatalf("expected %d bytes written, got %d", len(output), n)
+			}
+
+			if lines := drain(ch); !reflect.DeepEqual(lines, tc.lines) {
+				t.Errorf("expected lines %q, got %q", tc.lines, lines)
+			}
+			if d := out.Dropped(); d != tc.dropped {
+				t.Errorf("expected %d dropped lines, got %d", tc.dropped, d)
+			}
+		})
+	}
+
+	t.Run("block", func(t *testing.T) {
+		ch := make(chan string, 2)
+		out := NewOutputStream(ch, defaultLineBufferSize)
+
+		done := make(chan struct{})
+		go func() {
+			out.Write([]byte(output))
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("expected Write to block on the full channel")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// a slow consumer gets every line
+		var lines []string
+		for len(lines) < 5 {
+			time.Sleep(time.Millisecond)
+			lines = append(lines, <-ch)
+		}
+		<-done
+
+		expected := []string{"one", "two", "three", "four", "five"}
+		if !reflect.DeepEqual(lines, expected) {
+			t.Errorf("expected lines %q, got %q", expected, lines)
+		}
+		if d := out.Dropped(); d != 0 {
+			t.Errorf("expected no dropped lines, got %d", d)
+		}
+	})
+}
+
+func TestOutputStreamCRLF(t *testing.T) {
+	ch := make(chan string, 10)
+	out := NewOutputStream(ch, defaultLineBufferSize)
+
+	if _, err := out.Write([]byte("uciok\r\n  readyok\r\ninfo string a \n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the terminator is stripped from each line
+	expected := []string{"uciok", "  readyok", "info string a "}
+	if lines := drain(ch); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected lines %q, got %q", expected, lines)
+	}
+}
+
+func TestOutputStreamFlush(t *testing.T) {
+	ch := make(chan string, 10)
+	out := NewOutputStream(ch, defaultLineBufferSize)
+
+	// the final line is not terminated
+	if _, err := out.Write([]byte("info depth 1\nbestmove e2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := out.Write([]byte("e4")); err != nil {
+		t.Fatal(err)
+	}
+	if n := out.Lines(); n != 1 {
+		t.Fatalf("expected 1 line before flushing, got %d", n)
+	}
+
+	out.Flush()
+	expected := []string{"info depth 1", "bestmove e2e4"}
+	if lines := drain(ch); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected lines %q, got %q", expected, lines)
+	}
+	if n := out.Lines(); n != 2 {
+		t.Fatalf("expected 2 lines after flushing, got %d", n)
+	}
+
+	// nothing is buffered, so flushing again emits nothing
+	out.Flush()
+	if len(ch) != 0 || out.Lines() != 2 {
+		t.Fatalf("expected nothing emitted, got %q", drain(ch))
+	}
+
+	// a reset discards the partial line and the count
+	out.Write([]byte("partial"))
+	out.Reset()
+	out.Flush()
+	if len(ch) != 0 || out.Lines() != 0 {
+		t.Fatalf("expected nothing emitted after reset, got %q", drain(ch))
+	}
+}
+
+func TestOutputStreamLineLimit(t *testing.T) {
+	ch := make(chan string, 10)
+	out := NewOutputStream(ch, defaultLineBufferSize)
+	out.SetLineLimit(2)
+
+	if _, err := out.Write([]byte("one\ntwo\nthree\nfour\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"one", "two"}
+	if lines := drain(ch); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected lines %q, got %q", expected, lines)
+	}
+	if n, d := out.Lines(), out.Dropped(); n != 2 || d != 2 {
+		t.Fatalf("expected 2 lines and 2 dropped, got %d and %d", n, d)
+	}
+}
+
+func TestOutputStreamCarriageReturns(t *testing.T) {
+	writes := []string{
+		"Position: 1/3\rPosition: 2/3\r",
+		"Position: 3/3\r\n",
+		"Nodes searched: 1000\r",
+		"\n",
+		"Total time\r",
+		"Nodes/second: 5000\n",
+	}
+
+	tt := []struct {
+		name  string
+		split bool
+		lines []string
+	}{
+		{
+			name:  "off",
+			split: false,
+			lines: []string{
+				"Position: 1/3\rPosition: 2/3\rPosition: 3/3",
+				"Nodes searched: 1000\r",
+				"Total time\rNodes/second: 5000",
+			},
+		},
+		{
+			name:  "split",
+			split: true,
+			lines: []string{
+				"Position: 1/3",
+				"Position: 2/3",
+				"Position: 3/3",
+				"Nodes searched: 1000",
+				"Total time",
+				"Nodes/second: 5000",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan string, 16)
+			out := NewOutputStream(ch, defaultLineBufferSize)
+			out.SetSplitCarriageReturns(tc.split)
+
+			for _, w := range writes {
+				if _, err := out.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if lines := drain(ch); !reflect.DeepEqual(lines, tc.lines) {
+				t.Errorf("expected lines %q, got %q", tc.lines, lines)
+			}
+		})
+	}
+
+	// a trailing carriage return ends the line once the stream is flushed
+	ch := make(chan string, 4)
+	out := NewOutputStream(ch, defaultLineBufferSize)
+	out.SetSplitCarriageReturns(true)
+	out.Write([]byte("50%\r"))
+	if lines := drain(ch); len(lines) != 0 {
+		t.Fatalf("expected the line to be held, got %q", lines)
+	}
+	out.Flush()
+	if lines := drain(ch); !reflect.DeepEqual(lines, []string{"50%"}) {
+		t.Errorf("expected the held line, got %q", lines)
+	}
+}
@@ -22,13 +22,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"math"
+	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
-	"text/scanner"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,6 +40,18 @@ const (
 	// the default size of the channel (in number of strings) for the
 	// stdout of the engine
 	defaultStdoutChanSize = 4096
+
+	// the number of unread bestmoves kept when queueing bestmoves
+	bestmoveQueueSize = 16
+
+	// how long SendQuit waits for the engine to exit before killing it, unless
+	// set with SetQuitGrace
+	quitTimeout = 5 * time.Second
+
+	// how long to wait for the output of an engine that has exited to be
+	// closed, which a process it started may hold open, unless the command
+	// given to NewEngineFromCmd sets its own WaitDelay
+	outputWaitDelay = 5 * time.Second
 )
 
 // EngOption is a slice of option names and values
@@ -53,15 +69,30 @@ type EngOption struct {
 	Min     string   // min possible value of option
 	Max     string   // max possible value of option
 	Var     []string // predefined values of this parameter
+
+	// true for options named UCI_..., such as UCI_AnalyseMode or UCI_Elo,
+	// whose meaning is defined by the protocol and which GUIs usually set
+	// themselves rather than show to the user
+	Internal bool
 }
 
 // BestMove stores the most recent bestmove and ponder
 type BestMove struct {
 	BestMove string
 	Ponder   string
+
+	// any tokens following the move and ponder move, which some engines
+	// append although the protocol defines none
+	Extra []string
 }
 
-// Score is the score returned by the engine
+// Score is the score returned by the engine, from the point of view of the
+// side to move
+//
+// A mate score counts moves, not plies. It is positive if the side to move
+// delivers mate and negative if it gets mated, e.g. -1 means the opponent
+// mates with its next move. A mate score of 0 means the side to move is
+// already checkmated
 type Score struct {
 	Val        int  // score in centipawns or mate in moves
 	Lowerbound bool // true if the score is a lowerbound
@@ -69,55 +100,201 @@ type Score struct {
 	Mate       bool // false if val in centipawns, true if val is mate in moves
 }
 
+// String formats the score the way GUIs display it: centipawns as pawns with
+// a sign, e.g. "+1.23" or "-0.05" ("0.00" for an even score), and mate
+// scores as "#4" or "#-2". A lowerbound is marked with a trailing "↑" and an
+// upperbound with "↓", as the true score is at least or at most the value
+func (s Score) String() string {
+	var ret string
+
+	if s.Mate {
+		ret = "#" + strconv.Itoa(s.Val)
+	} else {
+		sign, val := "+", s.Val
+		if val < 0 {
+			sign, val = "-", -val
+		} else if val == 0 {
+			sign = ""
+		}
+		ret = fmt.Sprintf("%s%d.%02d", sign, val/100, val%100)
+	}
+
+	if s.Lowerbound {
+		ret += "↑"
+	}
+	if s.Upperbound {
+		ret += "↓"
+	}
+
+	return ret
+}
+
+// MateIn returns the number of moves to mate and whether the side to move is
+// the one delivering it. ok is false if the score is not a mate score
+func (s Score) MateIn() (moves int, favorable bool, ok bool) {
+	if !s.Mate {
+		return 0, false, false
+	}
+
+	if s.Val > 0 {
+		return s.Val, true, true
+	}
+
+	return -s.Val, false, true
+}
+
+// Refutation is a move found to be refuted, and the line refuting it
+type Refutation struct {
+	Move string   // the refuted move, empty if no refutation was sent
+	Line []string // the refuting line, empty if the move has no refutation
+}
+
 // Info returned from the engine
 type Info struct {
-	Depth          int      // search depth in plies
-	SelDepth       int      // selective search depth in plies
-	Time           int      // the time searched in ms
-	Nodes          int      // nodes searched
-	NodesPerSecond int      // nodes per second searched
-	PV             []string // the best line found
-	MultiPV        int      // multipv ranking, 0 if multipv not set
-	Score          Score    // score
-	CurrMove       string   // currently searching this move
-	CurrMoveNumber int      // currently searching this move number
-	HashFull       int      // the hash is x permill full
-	TBHits         int      // number of positions found in the endgame table bases
-	SBHits         int      // number of positions found in the shredder endgame databases
-	CPULoad        int      // CPU usage of the engine in permill
-	String         string   // any string str which will be displayed be the engine
-	Refutation     []string // first move refuted by the line of remaining moves
-	CurrLine       []string // current line the engine is calculating
+	Depth          int        // search depth in plies
+	SelDepth       int        // selective search depth in plies
+	Time           int64      // the time searched in ms
+	Nodes          int64      // nodes searched
+	NodesPerSecond int64      // nodes per second searched
+	PV             []string   // the best line found
+	MultiPV        int        // multipv ranking, 0 if multipv not set
+	Score          Score      // score
+	CurrMove       string     // currently searching this move
+	CurrMoveNumber int        // currently searching this move number
+	HashFull       int        // the hash is x permill full
+	TBHits         int64      // number of positions found in the endgame table bases
+	SBHits         int64      // number of positions found in the shredder endgame databases
+	CPULoad        int        // CPU usage of the engine in permill
+	String         string     // any string str which will be displayed be the engine
+	Refutation     Refutation // a move and the line refuting it
+	CurrLine       []string   // current line the engine is calculating
+	Raw            string     // the line exactly as it was received from the engine
+	Received       time.Time  // when the line was parsed, unlike Time which the engine reports
+
+	// tokens not known to the parser, mapped to the values that follow them
+	Extra map[string]string
+
+	hasScore bool // true if the line carried a score
+}
+
+// Duration returns the time searched (Time) as a time.Duration
+func (i Info) Duration() time.Duration {
+	return time.Duration(i.Time) * time.Millisecond
+}
+
+// NPS returns the nodes searched per second. This is the engine's own nps
+// value if it sent one, otherwise it is computed from Nodes and Time, or 0 if
+// either is missing
+func (i Info) NPS() int64 {
+	if i.NodesPerSecond > 0 {
+		return i.NodesPerSecond
+	}
+	if i.Nodes <= 0 || i.Time <= 0 {
+		return 0
+	}
+
+	return i.Nodes * 1000 / i.Time
+}
+
+// HashFullPercent returns how full the engine's hash table is as a percentage
+// from 0 to 100, converted from the permille HashFull. Values an engine sends
+// outside 0 to 1000 are clamped
+func (i Info) HashFullPercent() float64 {
+	return float64(min(max(i.HashFull, 0), 1000)) / 10
+}
+
+// searchResult is a bestmove along with the last info line of the search it
+// ended, which is empty if the search sent none
+type searchResult struct {
+	move BestMove
+	info Info
 }
 
 // EngChans are the channels used by the engine
 type EngChans struct {
-	readyOK    chan bool
-	bestMove   chan BestMove
-	doneStdout chan bool // stop stdout goroutines
-	uciOK      chan bool // wait for uciok line
+	readyOK    chan uint64 // the number of readyoks parsed, sent on each one
+	bestMove   chan searchResult
+	doneStdout chan bool     // stop stdout goroutines
+	parserDone chan struct{} // closed when the stdout goroutine returns
+	uciOK      chan bool     // wait for uciok line
 }
 
 // Engine holds information about the engine executable, the communication to
 // the engine, and information returned from the engine
 type Engine struct {
-	cmd    *exec.Cmd     // interface for the external engine program
-	stdin  *bufio.Writer // engine stdin buffer
-	stdout chan string   // stdout buffered channel
+	path    string        // path to the engine program
+	args    []string      // arguments passed to the engine program
+	opts    EngineOptions // options the engine was created with
+	cmd     *exec.Cmd     // interface for the external engine program
+	exited  chan struct{} // closed once the engine program has exited
+	waitErr error         // error waiting for the program, set before exited is closed
+	stdin   stdinWriter   // engine stdin, buffered unless disabled
+	stdinMu sync.Mutex    // makes each write and flush to stdin atomic
+	stdout  chan string   // stdout buffered channel
+	stream  *OutputStream // writes engine stdout to the stdout channel
+	readyMu sync.Mutex    // serializes isready round-trips
+	readyN  uint64        // isready commands sent by Ping, guarded by readyMu
+
+	readyRecv atomic.Uint64 // readyoks parsed
+
+	afterString atomic.Bool // true if the last line parsed was an info string
+
+	capture atomic.Pointer[lineCapture] // receives every line while benchmarking
+
+	recording bool     // true if commands sent are recorded, guarded by stdinMu
+	recorded  []string // commands sent while recording, guarded by stdinMu
+
+	batchOptions bool // hold back setoption writes until a flush, guarded by stdinMu
 
 	name   string // name specified by the engine
 	author string // author specified by the engine
 	dName  string // displayName specified by the GUI
 
+	banner     []string // lines sent by the engine outside the uci protocol
+	handshake  bool     // true once the engine has started answering uci
+	uciPending bool     // true from sending uci until uciok is received
+
 	defaultOptions []EngOption // options returned when sending uci to engine
 	setOptions     []EngOption // options set by GUI
 
+	optionUpdate *regexp.Regexp // matches info strings reporting option changes
+
+	presets map[string][]EngOption // named option sets for ApplyPreset
+
+	chess960 bool // true if UCI_Chess960 has been enabled
+	multiPV  int  // lines per search set with SetMultiPV, 0 if not set
+	game     game // the position most recently sent to the engine
+
+	sanConverter SANToUCI // converts the moves given to SendSANLine
+
 	infoBuf      []Info   // information returned by the engine
 	infoBufCap   int      // max capacity of the slice, or 0 if none specified
 	lastBestMove BestMove // most recent bestmove
+	bestMoveAt   uint64   // number of info lines parsed when it was received
+	lastInfo     Info     // last info line since the most recent bestmove
 	sync.RWMutex          // embedded mutex for editing the info buf, bestmove, and options
 
-	chans EngChans // internal channels used by the engine
+	queueBestMoves  bool // keep unread bestmoves instead of only the latest
+	keepInfoHistory bool // keep the info buffer when a new search starts
+	ignoreEchoes    bool // drop output lines that are commands echoed back
+
+	quitGrace time.Duration // how long SendQuit waits before killing the engine
+
+	// joins an info string to the one before it, see SetInfoStringJoin
+	joinStrings func(prev, next string) (string, bool)
+
+	searches   []*SearchHandle // searches started but not yet ended by a bestmove
+	searchID   uint64          // id of the most recently started search
+	outputDone bool            // true once the engine output is no longer parsed
+
+	lastSearch  *SearchHandle // the most recently completed search
+	infoTotal   uint64        // number of info lines parsed
+	subscribers []*subscriber // receivers of parsed info lines and bestmoves
+
+	logger atomic.Pointer[slog.Logger] // logs the protocol traffic, nil to discard
+
+	chans     EngChans  // internal channels used by the engine
+	closeOnce sync.Once // makes Close idempotent
 }
 
 // PrintInfo prints the name, author defaultOptions, and SetOptions
@@ -149,25 +326,147 @@ func (e *Engine) SetDisplayName(displayName string) {
 	e.dName = displayName
 }
 
+// SetLogger sets the logger used to trace the communication with the engine.
+// Each command sent and each line received is logged at debug level, and
+// lines that cannot be parsed are logged at error level. A nil logger (the
+// default) discards everything
+//
+// To tell several engines apart, pass a logger with an identifying attribute,
+// e.g. logger.With("engine", name)
+func (e *Engine) SetLogger(logger *slog.Logger) {
+	e.logger.Store(logger)
+}
+
+// discardLogger is used when no logger has been set. Its level is above every
+// record's, so nothing is formatted before being discarded
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard,
+	&slog.HandlerOptions{Level: slog.Level(math.MaxInt)}))
+
+// returns the logger set with SetLogger, or a logger that discards everything
+func (e *Engine) log() *slog.Logger {
+	if l := e.logger.Load(); l != nil {
+		return l
+	}
+
+	return discardLogger
+}
+
+// stdinWriter is the engine's stdin. Commands are written whole, so a flush
+// after each one leaves nothing buffered
+type stdinWriter interface {
+	io.Writer
+	io.StringWriter
+	Flush() error
+}
+
+// unbufferedWriter is a stdinWriter passing each write straight through
+type unbufferedWriter struct {
+	w io.Writer
+}
+
+func (u unbufferedWriter) Write(p []byte) (int, error) {
+	return u.w.Write(p)
+}
+
+func (u unbufferedWriter) WriteString(s string) (int, error) {
+	return io.WriteString(u.w, s)
+}
+
+// Flush does nothing, as nothing is ever buffered
+func (u unbufferedWriter) Flush() error {
+	return nil
+}
+
+// returns a writer to the engine's stdin with a buffer of size bytes, the
+// default size if size is 0, or no buffer if size is negative
+func newStdinWriter(w io.Writer, size int) stdinWriter {
+	switch {
+	case size < 0:
+		return unbufferedWriter{w}
+	case size == 0:
+		return bufio.NewWriter(w)
+	default:
+		return bufio.NewWriterSize(w, size)
+	}
+}
+
 // SendCommand sends a generic string to the engine without guarantee that
 // the command was accepted. The input command should not include a newline.
+//
+// It is safe to call SendCommand from multiple goroutines; each command is
+// written and flushed as a whole
 func (e *Engine) SendCommand(command string) error {
+	return e.send(command, false)
+}
+
+// writes a command to the engine and flushes it, along with any options
+// held back in batch mode. If option is true and batch mode is on, the
+// command is held back too
+func (e *Engine) send(command string, option bool) error {
+	e.stdinMu.Lock()
+	defer e.stdinMu.Unlock()
+
+	e.log().Debug("sent command", "command", command)
+
+	if e.recording {
+		e.recorded = append(e.recorded, command)
+	}
+
+	// writing only fails once the engine has closed its end of the pipe
 	_, err := e.stdin.WriteString(command + "\n")
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrEngineExited, err)
+	}
+
+	if option && e.batchOptions {
+		return nil
 	}
 
 	err = e.stdin.Flush()
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrEngineExited, err)
+	}
+
+	return nil
+}
+
+// SendRaw writes b to the engine verbatim and flushes it. Unlike
+// SendCommand no newline is added, so b may hold several commands, a partial
+// command, or none at all; terminating the commands is left to the caller.
+// Raw writes are not recorded by SetRecordCommands
+//
+// SendRaw is serialized with SendCommand, so b is never interleaved with
+// another command
+func (e *Engine) SendRaw(b []byte) error {
+	e.stdinMu.Lock()
+	defer e.stdinMu.Unlock()
+
+	e.log().Debug("sent raw bytes", "bytes", len(b))
+
+	if _, err := e.stdin.Write(b); err != nil {
+		return fmt.Errorf("%w: %w", ErrEngineExited, err)
+	}
+
+	if err := e.stdin.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrEngineExited, err)
 	}
 
 	return nil
 }
 
-// SendFEN updates the engine position with a FEN string
+// SendFEN updates the engine position with a FEN string. The FEN becomes the
+// start of the game tracked by PushMove
 func (e *Engine) SendFEN(fen string) error {
-	return e.SendCommand(fmt.Sprintf("position fen %s", fen))
+	return e.setGame(game{fen: fen})
+}
+
+// SendStartPos sets the engine position to the standard starting position,
+// which becomes the start of the game tracked by PushMove
+//
+// In Chess960 mode there is no single starting position, so the position
+// should be sent with SendFEN (or SendFENChecked) instead
+func (e *Engine) SendStartPos() error {
+	return e.setGame(game{})
 }
 
 // SendUCINewGame sends a ucinewgame command to the engine
@@ -181,30 +480,59 @@ func (e *Engine) SendStop() error {
 }
 
 // SendQuit sends a quit command to the engine and waits for the program to
-// exit
+// exit and all of its output to be parsed. An engine that has not exited
+// within the grace period set with SetQuitGrace, 5 seconds by default, is
+// killed, and an error wrapping ErrTimeout is returned. As with Close, only
+// the engine process is killed
 func (e *Engine) SendQuit() error {
 	if err := e.SendCommand("quit"); err != nil {
 		return err
 	}
 
-	// wait for stdout channel to finish
-	for len(e.stdout) > 0 {
-		time.Sleep(10 * time.Millisecond)
+	if e.exited == nil {
+		return nil
 	}
 
-	if err := e.cmd.Wait(); err != nil {
-		return err
+	e.RLock()
+	grace := e.quitGrace
+	e.RUnlock()
+	if grace <= 0 {
+		grace = quitTimeout
 	}
 
-	return nil
+	// the stdout channel is closed once the program has exited, and the
+	// parser stops once it has parsed every line
+	select {
+	case <-e.chans.parserDone:
+	case <-time.After(grace):
+		err := e.cmd.Process.Kill()
+		if err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("killing engine after it ignored quit: %w", err)
+		}
+
+		// output held open by a process the engine started is abandoned
+		// after the command's WaitDelay
+		<-e.exited
+		return fmt.Errorf("engine did not quit within %v and was killed: %w", grace, ErrTimeout)
+	}
+
+	// the parser may also have been stopped by Close
+	<-e.exited
+
+	return e.waitErr
 }
 
-// SendPonderHit sends a ponderhit command to the engine
-// func (e *Engine) SendPonderHit() error {
-// return e.SendCommand("ponderhit")
-// }
+// SetQuitGrace sets how long SendQuit waits for the engine to exit before
+// killing it. A grace of zero or less restores the default of 5 seconds
+func (e *Engine) SetQuitGrace(grace time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.quitGrace = grace
+}
 
-// SendOption sends an option to the engine
+// SendOption sends an option to the engine. In batch mode (see
+// SetBatchOptions) the option is written but not flushed
 func (e *Engine) SendOption(name, value string) error {
 	var sendString string
 
@@ -214,75 +542,265 @@ func (e *Engine) SendOption(name, value string) error {
 		sendString = fmt.Sprintf("setoption name %s value %s", name, value)
 	}
 
-	if err := e.SendCommand(sendString); err != nil {
+	if err := e.send(sendString, true); err != nil {
 		return err
 	}
 
-	setOption := EngOption{}
-	setOption.Name = name
-	setOption.Value = value
+	e.Lock()
+	defer e.Unlock()
 
-	// Updates the options sent to the engine, and overwrites previously
-	// set option with the same name
-	mergeSetOptions := func(prev []EngOption, new EngOption) []EngOption {
-		for i, v := range prev {
-			if v.Name == setOption.Name {
-				prev = append(prev[:i], prev[i+1:]...)
-				break
-			}
-		}
+	e.mergeSetOption(EngOption{Name: name, Value: value})
+
+	return nil
+}
 
-		prev = append(prev, new)
-		return prev
+// SetQueueBestMoves controls what happens to a bestmove that has not been
+// waited for when another one arrives. If queue is false (the default) the
+// older bestmove is discarded. If queue is true bestmoves are kept in order
+// and returned one at a time by WaitBestMove; only once bestmoveQueueSize
+// results are waiting is the oldest discarded
+func (e *Engine) SetQueueBestMoves(queue bool) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.queueBestMoves = queue
+}
+
+// SetKeepInfoHistory controls whether the info buffer is cleared when a
+// search is started with StartSearch or Go. By default it is, so GetInfo and
+// the analysis methods only see the lines of the latest search. If keep is
+// true, lines accumulate across searches up to the info buffer capacity
+func (e *Engine) SetKeepInfoHistory(keep bool) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.keepInfoHistory = keep
+}
+
+// SetIgnoreEchoes controls whether output lines starting with a command a
+// GUI sends, such as position, go, setoption, uci or isready, are ignored. A
+// few engines echo the commands they receive, which would otherwise be
+// parsed as info lines. It is off by default
+func (e *Engine) SetIgnoreEchoes(ignore bool) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.ignoreEchoes = ignore
+}
+
+// SetInfoStringJoin sets a rule for coalescing a long message an engine wraps
+// over several info string lines. When an info string line directly follows
+// another, join is called with the message so far and the new one; if it
+// returns true, the combined message it returns replaces the earlier line's
+// String, the line's Raw gains the new line, and no new Info is stored. For
+// example, to join lines continuing one that ends with a backslash:
+//
+//	eng.SetInfoStringJoin(func(prev, next string) (string, bool) {
+//		s, ok := strings.CutSuffix(prev, "\\")
+//		return s + next, ok
+//	})
+//
+// join is called by the goroutine parsing the engine output, without the
+// engine lock held, so it may call methods of the engine; no further output is
+// parsed until it returns. Subscribers, such as InfoSeq, still receive only
+// the first line of a joined message. A nil join, the default, turns joining
+// off
+func (e *Engine) SetInfoStringJoin(join func(prev, next string) (string, bool)) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.joinStrings = join
+}
+
+// SetChess960 enables or disables Chess960 (Fischer Random) mode by setting
+// the UCI_Chess960 option. In Chess960 mode engines encode castling as the
+// king capturing its own rook (e.g. "e1h1") in bestmove and pv output, and
+// FENs passed to SendFENChecked may use Shredder-FEN or X-FEN castling rights
+func (e *Engine) SetChess960(enabled bool) error {
+	if err := e.SendOption("UCI_Chess960", strconv.FormatBool(enabled)); err != nil {
+		return err
 	}
 
 	e.Lock()
 	defer e.Unlock()
 
-	e.setOptions = mergeSetOptions(e.setOptions, setOption)
+	e.chess960 = enabled
 
 	return nil
 }
 
-// WaitReadyOK sends isready to engine and waits for readyok
-// sets a 5s timeout and checks every 10ms for the readyok response
+// Chess960 returns true if Chess960 mode has been enabled with SetChess960
+func (e *Engine) Chess960() bool {
+	e.RLock()
+	defer e.RUnlock()
+
+	return e.chess960
+}
+
+// Banner returns the lines the engine sent outside the uci protocol: before
+// it started answering the uci command, such as a version banner printed on
+// startup, and the info lines (e.g. info string messages) and unknown lines
+// sent while answering it, before uciok
+func (e *Engine) Banner() []string {
+	e.RLock()
+	defer e.RUnlock()
+
+	ret := make([]string, len(e.banner))
+	copy(ret, e.banner)
+
+	return ret
+}
+
+// DroppedLines returns the number of lines of engine output discarded because
+// the stdout channel was full, which only happens with an OverflowPolicy
+// other than Block
+func (e *Engine) DroppedLines() uint64 {
+	if e.stream == nil {
+		return 0
+	}
+
+	return e.stream.Dropped()
+}
+
+// StdoutPending returns the number of lines of engine output waiting to be
+// parsed and the capacity of the stdout channel holding them. A count that
+// stays near the capacity means the parser is falling behind the engine; see
+// EngineOptions.StdoutChanSize
+func (e *Engine) StdoutPending() (n, capacity int) {
+	return len(e.stdout), cap(e.stdout)
+}
+
+// WaitReadyOK sends isready to engine and waits up to timeout for readyok
 //
-// Note: while isready can be sent to the engine at any time, even while the
-// engine is calculating, this function throws away any other output from the
-// engine while waiting for isready, so this should be used with care
+// isready can be sent to the engine at any time, even while the engine is
+// calculating. Output sent by the engine while waiting is still parsed as
+// normal, so info lines from a running search are not lost. Calls to
+// WaitReadyOK are serialized so that each call is matched with its own
+// readyok
 func (e *Engine) WaitReadyOK(timeout time.Duration) error {
+	_, err := e.Ping(timeout)
+	return err
+}
+
+// Ping checks that the engine is responsive by sending isready and waiting up
+// to timeout for readyok, like WaitReadyOK, and returns the round-trip time
+// from sending isready to parsing readyok. If the engine exits first, an
+// error wrapping ErrEngineExited is returned
+func (e *Engine) Ping(timeout time.Duration) (time.Duration, error) {
+	e.readyMu.Lock()
+	defer e.readyMu.Unlock()
+
+	// readyoks are counted so that one answering an earlier call that timed
+	// out is not taken for the answer to this call. A readyok the engine
+	// sent unasked only moves the count forward
+	if recv := e.readyRecv.Load(); recv > e.readyN {
+		e.readyN = recv
+	}
+
+	start := time.Now()
 	if err := e.SendCommand("isready"); err != nil {
-		return err
+		return 0, err
 	}
+	e.readyN++
 
 	timer := time.After(timeout)
 
 	for {
 		select {
 		case <-timer:
-			return errors.New("timed out")
-		case <-e.chans.readyOK:
-			return nil
+			return 0, fmt.Errorf("waiting for readyok: %w", ErrTimeout)
+		case n := <-e.chans.readyOK:
+			if n >= e.readyN {
+				return time.Since(start), nil
+			}
+		case <-e.chans.parserDone:
+			// the readyok may have been the last line parsed
+			select {
+			case n := <-e.chans.readyOK:
+				if n >= e.readyN {
+					return time.Since(start), nil
+				}
+			default:
+			}
+			return 0, fmt.Errorf("waiting for readyok: %w", ErrEngineExited)
 		}
 	}
 }
 
 // WaitBestMove waits for the bestmove to be sent
+//
+// While the engine is pondering the bestmove is withheld, so WaitBestMove
+// only returns once ponderhit has been sent and the search has finished, or
+// the search has been stopped
+//
+// By default only the most recent bestmove is kept: a bestmove that has not
+// been waited for is discarded when the next one arrives, so WaitBestMove
+// always returns the result of the latest search. Use SetQueueBestMoves to
+// keep earlier results instead
+//
+// If the engine exits without sending a bestmove, an error wrapping
+// ErrEngineExited is returned without waiting for the timeout
 func (e *Engine) WaitBestMove(timeout time.Duration) (BestMove, error) {
+	r, err := e.waitSearchResult(timeout)
+	return r.move, err
+}
+
+// WaitBestMoveWithInfo is like WaitBestMove, but also returns the last info
+// line the engine sent before the bestmove, which normally holds the final
+// depth, score and pv of the search. Both come from the same search: if the
+// engine sent no info lines between the previous bestmove and this one, the
+// returned Info is empty, with an empty Raw line
+func (e *Engine) WaitBestMoveWithInfo(timeout time.Duration) (BestMove, Info, error) {
+	r, err := e.waitSearchResult(timeout)
+	return r.move, r.info, err
+}
+
+// waits for the next bestmove and the last info line of its search
+func (e *Engine) waitSearchResult(timeout time.Duration) (searchResult, error) {
 	if e.chans.bestMove == nil {
-		return BestMove{}, errors.New("bestMove channel not made")
+		return searchResult{}, fmt.Errorf("bestmove: %w", ErrChannelNotReady)
 	}
 
 	timer := time.After(timeout)
 
 	select {
-	case b := <-e.chans.bestMove:
-		return b, nil
+	case r := <-e.chans.bestMove:
+		return r, nil
+	case <-e.chans.parserDone:
+		// bestmoves parsed before the output ended are still delivered
+		select {
+		case r := <-e.chans.bestMove:
+			return r, nil
+		default:
+		}
+		return searchResult{}, fmt.Errorf("waiting for bestmove: %w", ErrEngineExited)
 	case <-timer:
-		return BestMove{}, errors.New("timed out")
+		return searchResult{}, fmt.Errorf("waiting for bestmove: %w", ErrTimeout)
+	}
+}
+
+// discards the bestmoves that have not been waited for. The caller must hold
+// the engine lock
+func (e *Engine) drainBestMoves() {
+	for {
+		select {
+		case <-e.chans.bestMove:
+		default:
+			return
+		}
 	}
 }
 
+// ClearInfo empties the info buffer, e.g. so that the output for each of a
+// series of positions starts clean. Starting a search clears the buffer too,
+// unless SetKeepInfoHistory is on
+func (e *Engine) ClearInfo() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.infoBuf = nil
+}
+
 // GetInfo returns the last info lines returned by the engine, or all lines if
 // last is negative
 func (e *Engine) GetInfo(last int) []Info {
@@ -291,7 +809,7 @@ func (e *Engine) GetInfo(last int) []Info {
 	e.RLock()
 	defer e.RUnlock()
 
-	if last < 0 || last > e.infoBufCap {
+	if last < 0 || last > len(e.infoBuf) {
 		ret = make([]Info, len(e.infoBuf))
 		copy(ret, e.infoBuf)
 	} else {
@@ -303,72 +821,89 @@ func (e *Engine) GetInfo(last int) []Info {
 
 }
 
-// parses the output of the uci command
-func (e *Engine) parseUCILine(s []string) {
-	f := func(s []string) (string, int) {
-		keywords := []string{"name", "type", "default", "min", "max", "var"}
-		ret := ""
-		var i int
+// GetInfoMultiPV returns the last info lines for the multipv rank index, or
+// all of its lines if last is negative. Lines without multipv set are treated
+// as rank 1, and lines without a pv (e.g. currmove updates) are left out
+func (e *Engine) GetInfoMultiPV(index int, last int) []Info {
+	e.RLock()
+	defer e.RUnlock()
 
-	Outer:
-		for _, v := range s {
-			for _, k := range keywords {
-				if v == k {
-					break Outer
-				}
-			}
-			i++
+	ret := []Info{}
+	for _, info := range e.infoBuf {
+		rank := info.MultiPV
+		if rank == 0 {
+			rank = 1
 		}
 
-		ret = strings.Join(s[:i], " ")
-		if ret == "<empty>" {
-			ret = ""
-		}
-		return ret, i
-	}
-
-	lineOptions := EngOption{}
-
-	for i := 0; i < len(s); i++ {
-		var skip int
-
-		switch s[i] {
-		case "name":
-			lineOptions.Name, skip = f(s[i+1:])
-			i += skip
-		case "type":
-			lineOptions.Type, skip = f(s[i+1:])
-			i += skip
-		case "default":
-			lineOptions.Default, skip = f(s[i+1:])
-			i += skip
-		case "min":
-			lineOptions.Min, skip = f(s[i+1:])
-			i += skip
-		case "max":
-			lineOptions.Max, skip = f(s[i+1:])
-			i += skip
-		case "var":
-			opt, skip := f(s[i+1:])
-			lineOptions.Var = append(lineOptions.Var, opt)
-			i += skip
+		if rank == index && len(info.PV) > 0 {
+			ret = append(ret, info)
 		}
 	}
 
+	if last >= 0 && last < len(ret) {
+		ret = ret[len(ret)-last:]
+	}
+
+	return ret
+}
+
+// parses an option line sent in reply to the uci command and adds the option
+// to the engine's default options
+func (e *Engine) parseUCILine(line string) error {
+	o, err := ParseOption(line)
+	if err != nil {
+		return err
+	}
+
 	e.Lock()
 	defer e.Unlock()
 
-	e.defaultOptions = append(e.defaultOptions, lineOptions)
+	e.defaultOptions = append(e.defaultOptions, o)
+
+	return nil
 }
 
 // UCI sends the uci command to the engine and sets up values in the Engine
 // struct
 func (e *Engine) UCI() error {
-	if err := e.SendCommand("uci"); err != nil {
+	return e.uci(0)
+}
+
+// sends uci and waits up to timeout for uciok, or without a limit if timeout
+// is zero
+func (e *Engine) uci(timeout time.Duration) error {
+	// discard a spurious uciok sent before the command
+	select {
+	case <-e.chans.uciOK:
+	default:
+	}
+
+	// output until uciok is part of the handshake, not a search
+	e.Lock()
+	e.uciPending = true
+	e.Unlock()
+
+	// a uciok arriving after a failed handshake answers no request
+	fail := func(err error) error {
+		e.Lock()
+		e.uciPending = false
+		e.Unlock()
 		return err
 	}
 
-	<-e.chans.uciOK
+	if err := e.SendCommand("uci"); err != nil {
+		return fail(err)
+	}
+
+	if timeout == 0 {
+		<-e.chans.uciOK
+	} else {
+		select {
+		case <-e.chans.uciOK:
+		case <-time.After(timeout):
+			return fail(fmt.Errorf("waiting for uciok: %w", ErrTimeout))
+		}
+	}
 
 	e.Lock()
 	defer e.Unlock()
@@ -380,8 +915,245 @@ func (e *Engine) UCI() error {
 	return nil
 }
 
+// keywords of the info command
+var infoKeywords = map[string]bool{
+	"depth": true, "seldepth": true, "time": true, "nodes": true,
+	"pv": true, "multipv": true, "score": true, "currmove": true,
+	"currmovenumber": true, "hashfull": true, "nps": true, "tbhits": true,
+	"sbhits": true, "cpuload": true, "string": true, "refutation": true,
+	"currline": true,
+}
+
+// parseInfo parses an info line sent by the engine. Tokens that are not
+// keywords of the info command are collected into Info.Extra along with the
+// values following them, up to the next known keyword or the first word after
+// numeric values. Numeric fields sent as floats are truncated
+func parseInfo(line string) (Info, error) {
+	info := Info{}
+	fields := uciFields(line)
+
+	// start of each field in the line, so text can be taken verbatim
+	offsets := make([]int, len(fields))
+	pos := 0
+	for k, f := range fields {
+		pos += strings.Index(line[pos:], f)
+		offsets[k] = pos
+		pos += len(f)
+	}
+
+	var i int
+
+	// returns the token following the current keyword
+	value := func() (string, error) {
+		if i+1 >= len(fields) {
+			return "", fmt.Errorf("info %s has no value", fields[i])
+		}
+		i++
+		return fields[i], nil
+	}
+
+	atoi := func(dest *int) error {
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		n, err := parseInfoInt(v, strconv.IntSize)
+		*dest = int(n)
+		return err
+	}
+
+	// counters that can exceed 32 bits in long searches
+	atoi64 := func(dest *int64) error {
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		*dest, err = parseInfoInt(v, 64)
+		return err
+	}
+
+	// returns the remaining tokens on the line
+	rest := func() []string {
+		ret := fields[i+1:]
+		i = len(fields)
+		return ret
+	}
+
+	var err error
+	for i = 0; i < len(fields) && err == nil; i++ {
+		switch fields[i] {
+		case "info":
+		case "depth":
+			err = atoi(&info.Depth)
+		case "seldepth":
+			err = atoi(&info.SelDepth)
+		case "time":
+			err = atoi64(&info.Time)
+		case "nodes":
+			err = atoi64(&info.Nodes)
+		case "nps":
+			err = atoi64(&info.NodesPerSecond)
+		case "pv": // assumes pv is at the end of the line
+			info.PV = rest()
+		case "multipv":
+			err = atoi(&info.MultiPV)
+		case "score":
+			var kind string
+			if kind, err = value(); err != nil {
+				break
+			}
+			info.Score.Mate = kind == "mate"
+			if err = atoi(&info.Score.Val); err != nil {
+				break
+			}
+			info.hasScore = true
+
+			// the bound, if any, directly follows the score
+			if i+1 < len(fields) {
+				switch fields[i+1] {
+				case "lowerbound":
+					info.Score.Lowerbound = true
+					i++
+				case "upperbound":
+					info.Score.Upperbound = true
+					i++
+				}
+			}
+		case "currmove":
+			info.CurrMove, err = value()
+		case "currmovenumber":
+			err = atoi(&info.CurrMoveNumber)
+		case "hashfull":
+			err = atoi(&info.HashFull)
+		case "tbhits":
+			err = atoi64(&info.TBHits)
+		case "sbhits":
+			err = atoi64(&info.SBHits)
+		case "cpuload":
+			err = atoi(&info.CPULoad)
+		case "string":
+			// the rest of the line after the separator following the
+			// keyword, keeping any significant whitespace
+			start := offsets[i] + len(fields[i])
+			if start < len(line) {
+				start++
+			}
+			info.String = line[start:]
+			i = len(fields)
+		case "refutation": // assumes refutation at end of line
+			moves := rest()
+			if len(moves) == 0 {
+				err = errors.New("info refutation has no move")
+				break
+			}
+
+			info.Refutation.Move = moves[0]
+			if len(moves) > 1 {
+				info.Refutation.Line = moves[1:]
+			}
+		case "currline":
+			info.CurrLine = rest()
+		default:
+			// unknown token, take its values up to the next keyword. A
+			// word following numeric values starts another unknown token,
+			// as in Lc0's "movesleft 60 wv 0.22"
+			key := fields[i]
+			j := i + 1
+			for j < len(fields) && !infoKeywords[fields[j]] {
+				if j > i+1 && isNumeric(fields[j-1]) && !isNumeric(fields[j]) {
+					break
+				}
+				j++
+			}
+
+			if info.Extra == nil {
+				info.Extra = map[string]string{}
+			}
+			info.Extra[key] = strings.Join(fields[i+1:j], " ")
+			i = j - 1
+		}
+	}
+
+	return info, err
+}
+
+// parses the value of a numeric info field. Some engines, e.g. Lc0, send
+// values such as nps formatted as floats; these are truncated towards zero
+func parseInfoInt(s string, bitSize int) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, bitSize)
+	if err == nil {
+		return n, nil
+	}
+
+	f, ferr := strconv.ParseFloat(s, 64)
+	if ferr != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, err
+	}
+
+	// out of range floats are rejected like out of range integers
+	t := math.Trunc(f)
+	limit := math.Ldexp(1, bitSize-1)
+	if t >= limit || t < -limit {
+		return 0, err
+	}
+
+	return int64(t), nil
+}
+
+// returns true if s is an integer or float value
+func isNumeric(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// the characters separating the tokens of a command
+const uciSpace = " \t\r\n"
+
+// splits a line of engine output into tokens separated by ASCII whitespace.
+// Unlike strings.Fields, other unicode spaces, such as a no-break space in an
+// engine name or file path, are kept within their token
+func uciFields(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool {
+		return strings.ContainsRune(uciSpace, r)
+	})
+}
+
+// removes a single line terminator, "\n" or "\r\n", from the end of a line of
+// engine output. Any other whitespace may be significant, e.g. in the message
+// of an info string, and is kept
+func trimLine(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
+
 // parses the stdout of the engine
 func (e *Engine) parseStdout(line string) error {
+	raw := line
+	line = trimLine(line)
+
+	e.log().Debug("received line", "line", line)
+
+	// blank lines, such as the one Stockfish sends after its id, carry nothing
+	if line == "" || e.isEcho(line) {
+		return nil
+	}
+
+	// while benchmarking, only lines of the protocol are parsed as well
+	if e.captureLine(line) {
+		switch first, _, _ := strings.Cut(line, " "); first {
+		case "info", "bestmove", "readyok":
+		default:
+			return nil
+		}
+	}
+
+	// only an info string directly after another can continue it
+	afterString := e.afterString.Swap(false)
+
+	if e.captureBanner(line) {
+		return nil
+	}
+
 	// check the prefix
 	index := strings.IndexByte(line, ' ')
 	if index != -1 {
@@ -389,163 +1161,123 @@ func (e *Engine) parseStdout(line string) error {
 		case "bestmove":
 			e.Lock()
 
-			lineSlice := strings.Split(line, " ")
-
-			e.lastBestMove.BestMove = lineSlice[1]
+			lineSlice := uciFields(line)
 
-			if len(lineSlice) > 2 {
-				e.lastBestMove.Ponder = lineSlice[3]
-			} else {
-				e.lastBestMove.Ponder = ""
+			e.lastBestMove.BestMove = ""
+			if len(lineSlice) > 1 {
+				e.lastBestMove.BestMove = lineSlice[1]
 			}
 
-			b := BestMove{e.lastBestMove.BestMove, e.lastBestMove.Ponder}
+			// a ponder of "(none)" or "0000", sent by some engines when
+			// there is no move to ponder on, is no ponder at all
+			e.lastBestMove.Ponder = ""
+			extra := 2
+			if len(lineSlice) > 2 && lineSlice[2] == "ponder" {
+				extra = min(4, len(lineSlice))
+				if len(lineSlice) > 3 && lineSlice[3] != noMove && lineSlice[3] != nullMove {
+					e.lastBestMove.Ponder = lineSlice[3]
+				}
+			}
 
-			e.Unlock()
+			e.lastBestMove.Extra = nil
+			if len(lineSlice) > extra {
+				e.lastBestMove.Extra = lineSlice[extra:]
+			}
 
-		Loop:
-			// explicitly empty the channel
-			for {
-				select {
-				case <-e.chans.bestMove:
-				default:
-					break Loop
+			b := e.lastBestMove
+			e.bestMoveAt = e.infoTotal
+			r := searchResult{move: b, info: e.lastInfo}
+			e.lastInfo = Info{}
+
+			e.publishBestMove(b)
+
+			// queued under the lock, so a search starting concurrently
+			// cannot miss the bestmove when it discards unread ones
+			if e.queueBestMoves {
+				// make room for the new bestmove if the queue is full
+				if len(e.chans.bestMove) == cap(e.chans.bestMove) {
+					select {
+					case <-e.chans.bestMove:
+					default:
+					}
 				}
+			} else {
+				e.drainBestMoves()
 			}
 
-			e.chans.bestMove <- b
+			e.chans.bestMove <- r
+
+			e.Unlock()
 			return nil
 		case "id":
 			e.Lock()
 			defer e.Unlock()
 
-			lineSlice := strings.Fields(line)
-			if lineSlice[1] == "name" {
-				e.name = strings.Join(lineSlice[2:], " ")
-			} else if lineSlice[1] == "author" {
-				e.author = strings.Join(lineSlice[2:], " ")
+			// the name and author are free text, taken verbatim
+			key, value := strings.TrimLeft(line[index:], uciSpace), ""
+			if k := strings.IndexAny(key, uciSpace); k != -1 {
+				key, value = key[:k], strings.Trim(key[k:], uciSpace)
+			}
+			if key == "name" {
+				e.name = value
+			} else if key == "author" {
+				e.author = value
 			}
 			return nil
 		case "option":
-			lineSlice := strings.Fields(line)
-			e.parseUCILine(lineSlice[1:])
-			return nil
+			return e.parseUCILine(line)
 		}
 	}
 
 	if strings.HasPrefix(line, "uciok") {
-		e.chans.uciOK <- true
+		// a uciok only answers a handshake in progress, not one that has
+		// already failed
+		e.Lock()
+		pending := e.uciPending
+		e.uciPending = false
+		e.Unlock()
+		if !pending {
+			return nil
+		}
+
+		// never block the parser on a duplicate or unexpected uciok
+		select {
+		case e.chans.uciOK <- true:
+		default:
+		}
 		return nil
 	} else if strings.HasPrefix(line, "readyok") {
-		e.chans.readyOK <- true
+		// never block the parser if nobody is waiting for the readyok. Only
+		// the parser sends, so once an unread count is replaced there is
+		// room for the new one
+		n := e.readyRecv.Add(1)
+		select {
+		case <-e.chans.readyOK:
+		default:
+		}
+		select {
+		case e.chans.readyOK <- n:
+		default:
+		}
 		return nil
 	}
 
-	var err error
-	rd := strings.NewReader(line)
-	s := scanner.Scanner{}
-	s.Init(rd)
-	s.Mode = scanner.ScanIdents | scanner.ScanChars | scanner.ScanInts
-
-	atoi := func(dest int, s scanner.Scanner) error {
-		s.Scan()
-		dest, err = strconv.Atoi(s.TokenText())
+	info, err := parseInfo(line)
+	if err != nil {
 		return err
 	}
+	info.Raw = raw
+	info.Received = time.Now()
 
-	info := Info{}
-	var StringSlice []string
-	for s.Scan() != scanner.EOF {
-		switch s.TokenText() {
-		case "info":
-		case "depth":
-			if err = atoi(info.Depth, s); err != nil {
-				return err
-			}
-		case "seldepth":
-			if err = atoi(info.SelDepth, s); err != nil {
-				return err
-			}
-		case "time":
-			if err = atoi(info.Time, s); err != nil {
-				return err
-			}
-		case "nodes":
-			if err = atoi(info.Nodes, s); err != nil {
-				return err
-			}
-		case "nps":
-			if err = atoi(info.NodesPerSecond, s); err != nil {
-				return err
-			}
-		case "pv": // assumes pv is at the end of the line
-			for s.Scan() != scanner.EOF {
-				info.PV = append(info.PV, s.TokenText())
-			}
-		case "multipv":
-			if err = atoi(info.MultiPV, s); err != nil {
-				return err
-			}
-		case "score":
-			s.Scan()
-			switch s.TokenText() {
-			case "cp":
-				s.Scan()
-			case "mate":
-				info.Score.Mate = true
-				s.Scan()
-			}
-			neg := 1
-			if s.TokenText() == "-" {
-				neg = -1
-				s.Scan()
-			}
-			info.Score.Val, err = strconv.Atoi(s.TokenText())
-			if err != nil {
-				return err
-			}
-			info.Score.Val *= neg
-		case "currmove":
-			s.Scan()
-			info.CurrMove = s.TokenText()
-		case "currmovenumber":
-			if err = atoi(info.CurrMoveNumber, s); err != nil {
-				return err
-			}
-		case "hashfull":
-			if err = atoi(info.HashFull, s); err != nil {
-				return err
-			}
-		case "tbhits":
-			if err = atoi(info.TBHits, s); err != nil {
-				return err
-			}
-		case "sbhits":
-			if err = atoi(info.SBHits, s); err != nil {
-				return err
-			}
-		case "cpuload":
-			if err = atoi(info.CPULoad, s); err != nil {
-				return err
-			}
-		case "string":
-			for s.Scan() != scanner.EOF {
-				StringSlice = append(StringSlice, s.TokenText())
-			}
-		case "refutation": // assumes refutation at end of line
-			for s.Scan() != scanner.EOF {
-				info.Refutation = append(info.Refutation, s.TokenText())
-			}
-		case "currline":
-			for s.Scan() != scanner.EOF {
-				info.CurrLine = append(info.CurrLine, s.TokenText())
-			}
+	isString := strings.HasPrefix(strings.TrimLeft(line, uciSpace), "info string")
+	if isString {
+		e.afterString.Store(true)
+
+		if afterString && e.joinInfoString(info.String, raw) {
+			return nil
 		}
 	}
 
-	// put string slice into a single string separated by spaces
-	info.String = strings.Join(StringSlice, " ")
-
 	e.Lock()
 	defer e.Unlock()
 
@@ -555,29 +1287,139 @@ func (e *Engine) parseStdout(line string) error {
 	} else {
 		e.infoBuf = append(e.infoBuf, info)
 	}
+	e.infoTotal++
+	e.lastInfo = info
+
+	if info.String != "" {
+		e.updateOptionFromInfo(info.String)
+	}
+	e.publishInfo(info)
 
 	return nil
 }
 
+// joins an info string to the line before it with the rule set by
+// SetInfoStringJoin, returning true if it did. The rule is called without the
+// engine lock held, so it may use the engine
+func (e *Engine) joinInfoString(next, raw string) bool {
+	e.RLock()
+	join := e.joinStrings
+	n, total := len(e.infoBuf), e.infoTotal
+	prev := ""
+	if n > 0 {
+		prev = e.infoBuf[n-1].String
+	}
+	e.RUnlock()
+
+	if join == nil || n == 0 {
+		return false
+	}
+
+	joined, ok := join(prev, next)
+	if !ok {
+		return false
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	// only the parser adds lines, but the buffer may have been cleared
+	if len(e.infoBuf) == 0 || e.infoTotal != total {
+		return false
+	}
+
+	last := &e.infoBuf[len(e.infoBuf)-1]
+	last.String = joined
+	if !strings.HasSuffix(last.Raw, "\n") {
+		last.Raw += "\n"
+	}
+	last.Raw += raw
+	e.lastInfo = *last
+
+	return true
+}
+
+// commands a GUI sends to an engine, which never start a line of engine output
+var guiCommands = map[string]bool{
+	"uci": true, "debug": true, "isready": true, "setoption": true,
+	"register": true, "ucinewgame": true, "position": true, "go": true,
+	"stop": true, "ponderhit": true, "quit": true,
+}
+
+// returns true if ignoring echoes is on and line is a command echoed back by
+// the engine
+func (e *Engine) isEcho(line string) bool {
+	e.RLock()
+	ignore := e.ignoreEchoes
+	e.RUnlock()
+
+	first, _, _ := strings.Cut(line, " ")
+
+	return ignore && guiCommands[first]
+}
+
+// stores line as part of the banner if it was sent before the engine started
+// answering uci, or is an info line or unknown line sent while the engine is
+// answering it, returning true if it did. The id and option lines of the
+// handshake and uciok are never part of the banner
+func (e *Engine) captureBanner(line string) bool {
+	e.Lock()
+	defer e.Unlock()
+
+	switch first, _, _ := strings.Cut(line, " "); first {
+	case "id", "option":
+		e.handshake = true
+		return false
+	case "uciok":
+		e.handshake = true
+		return false
+	case "readyok", "bestmove":
+		return false
+	case "info":
+		if !e.uciPending {
+			return false
+		}
+	default:
+		if e.handshake && !e.uciPending {
+			return false
+		}
+	}
+
+	e.banner = append(e.banner, line)
+
+	return true
+}
+
 // startStdoutParsing starts a goroutine that continually parses information
 // sent by the engine
 //
 // Once parsing has started it cannot be stopped until the engine is stopped
-//
-// TODO: handle error better
 func (e *Engine) startStdoutParsing() error {
-	e.chans.readyOK = make(chan bool)
+	e.chans.readyOK = make(chan uint64, 1)
 	e.chans.doneStdout = make(chan bool)
-	e.chans.bestMove = make(chan BestMove, 16)
-	e.chans.uciOK = make(chan bool)
+	e.chans.bestMove = make(chan searchResult, bestmoveQueueSize)
+	e.chans.uciOK = make(chan bool, 1)
+	e.chans.parserDone = make(chan struct{})
 
 	go func() error {
+		defer close(e.chans.parserDone)
+
+		// no bestmove can end a search once the output has all been parsed
+		defer e.endSearches()
+
 		for {
 			select {
-			case line := <-e.stdout:
-				err := e.parseStdout(strings.Trim(line, "\n"))
+			case line, ok := <-e.stdout:
+				if !ok {
+					return nil
+				}
+
+				// a line that cannot be parsed is dropped, the rest of
+				// the output is still useful
+				err := e.parseStdout(line)
 				if err != nil {
-					log.Fatalf("%v\n", err)
+					e.log().Error("parsing engine output",
+						"line", trimLine(line), "err", err)
 				}
 			case <-e.chans.doneStdout:
 				return nil
@@ -599,54 +1441,193 @@ func (e *Engine) startStdoutParsing() error {
 func NewEngineFromPath(path, displayName string, infoBufCap,
 	lineBufSize int, args ...string) (*Engine, error) {
 
-	eng := Engine{}
-	eng.cmd = exec.Command(path, args...)
+	return NewEngineWithOptions(path, EngineOptions{
+		DisplayName: displayName,
+		InfoBufCap:  infoBufCap,
+		LineBufSize: lineBufSize,
+	}, args...)
+}
+
+// EngineOptions hold the settings for starting an engine with
+// NewEngineWithOptions. The zero value uses the defaults for everything
+type EngineOptions struct {
+	// name to display for the engine. If empty, the name given by the engine
+	// is used once UCI() is called
+	DisplayName string
+
+	// max capacity of the info buffer, 0 for no limit
+	InfoBufCap int
+
+	// size in bytes of the buffer for a single line of engine output, 0 for
+	// the default size
+	LineBufSize int
+
+	// capacity in lines of the channel between the engine output and the
+	// parser, 0 for the default of 4096. The parser normally keeps up with
+	// any engine, but if it is held up (e.g. by a slow subscriber or a long
+	// held lock) and the channel fills, reading from the engine stalls until
+	// there is room, and an engine blocked writing its output stops
+	// responding. A larger channel absorbs longer stalls at the cost of
+	// memory
+	StdoutChanSize int
+
+	// what to do with a line of engine output when the stdout channel is
+	// full. The default, Block, never loses output. The other policies keep
+	// reading from the engine, dropping lines; see DroppedLines
+	OverflowPolicy OverflowPolicy
+
+	// treat a carriage return not followed by a newline as the end of a
+	// line, so status lines an engine redraws in place (e.g. progress during
+	// bench) are parsed as separate lines. Off by default
+	SplitCarriageReturns bool
+
+	// size in bytes of the buffer for commands sent to the engine, 0 for the
+	// default of 4096 or negative to write each command straight to the
+	// engine. Every command is flushed as it is sent, so the buffer only
+	// matters in batch mode (see SetBatchOptions), where a buffer large
+	// enough for all the options lets them reach the engine in one write.
+	// Without a buffer, batch mode has no effect
+	StdinBufSize int
+
+	// parse the engine's stderr along with its stdout, for engines that
+	// write some of their output there, such as the summary of Stockfish's
+	// bench. Off by default, leaving stderr unread
+	MergeStderr bool
+}
+
+// NewEngineWithOptions returns an Engine it has spun up given a path and
+// connected communication to, configured by opts
+//
+// args are optional
+func NewEngineWithOptions(path string, opts EngineOptions, args ...string) (*Engine, error) {
+	e := &Engine{}
+	e.path = path
+	e.args = append([]string(nil), args...)
+
+	return e.start(exec.Command(path, args...), opts)
+}
+
+// NewEngineFromCmd returns an Engine it has spun up by starting cmd and
+// connected communication to, for engines that need a command NewEngineFromPath
+// cannot build: run under a wrapper such as nice, taskset or firejail, in a
+// container, or with its own environment, working directory or SysProcAttr.
+// The displayName, infoBufCap and lineBufSize are as for NewEngineFromPath
+//
+// cmd must not have been started, and its Stdin and Stdout must not be set;
+// the engine connects them. If its WaitDelay is zero, it is set to 5 seconds,
+// see Close. An engine made this way cannot be cloned
+func NewEngineFromCmd(cmd *exec.Cmd, displayName string, infoBufCap,
+	lineBufSize int) (*Engine, error) {
+
+	if cmd.Process != nil {
+		return nil, errors.New("engine command already started")
+	}
+	if cmd.Stdin != nil || cmd.Stdout != nil {
+		return nil, errors.New("engine command stdin and stdout must not be set")
+	}
+
+	e := &Engine{}
+	return e.start(cmd, EngineOptions{
+		DisplayName: displayName,
+		InfoBufCap:  infoBufCap,
+		LineBufSize: lineBufSize,
+	})
+}
+
+// connects to the engine program run by cmd, starts it and starts parsing its
+// output
+func (e *Engine) start(cmd *exec.Cmd, opts EngineOptions) (*Engine, error) {
+	e.opts = opts
+	e.cmd = cmd
 
-	stdin, err := eng.cmd.StdinPipe()
+	stdin, err := e.cmd.StdinPipe()
 	if err != nil {
 		return nil, err
 	}
 
-	stdout := make(chan string, defaultStdoutChanSize)
-	if lineBufSize == 0 {
-		eng.cmd.Stdout = NewOutputStream(stdout, defaultLineBufferSize)
-	} else {
-		eng.cmd.Stdout = NewOutputStream(stdout, lineBufSize)
+	chanSize := opts.StdoutChanSize
+	if chanSize <= 0 {
+		chanSize = defaultStdoutChanSize
+	}
+	lineBufSize := opts.LineBufSize
+	if lineBufSize <= 0 {
+		lineBufSize = defaultLineBufferSize
 	}
 
-	eng.stdin = bufio.NewWriter(stdin)
-	eng.stdout = stdout
+	stdout := make(chan string, chanSize)
+	e.stream = NewOutputStreamWithPolicy(stdout, lineBufSize, opts.OverflowPolicy)
+	e.stream.SetSplitCarriageReturns(opts.SplitCarriageReturns)
+	e.cmd.Stdout = e.stream
+	if opts.MergeStderr {
+		// with the same writer for both, exec gives them one pipe, so the
+		// stream is only ever written by one goroutine
+		e.cmd.Stderr = e.stream
+	}
 
-	eng.dName = displayName
+	// don't let a process the engine started keep its output open, and the
+	// engine from being waited for, once the engine has exited
+	if e.cmd.WaitDelay == 0 {
+		e.cmd.WaitDelay = outputWaitDelay
+	}
 
-	if infoBufCap < 0 {
-		eng.infoBufCap = 0
+	e.stdin = newStdinWriter(stdin, opts.StdinBufSize)
+	e.stdout = stdout
+
+	e.dName = opts.DisplayName
+
+	if opts.InfoBufCap < 0 {
+		e.infoBufCap = 0
 	} else {
-		eng.infoBufCap = infoBufCap
+		e.infoBufCap = opts.InfoBufCap
 	}
 
-	if err = eng.startStdoutParsing(); err != nil {
-		return nil, err
+	// nothing is running until the program has started, so there is nothing
+	// to clean up if it cannot be. Output written before the parser starts
+	// waits in the stdout channel
+	if err := e.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting engine %q: %w", e.cmd.Path, err)
 	}
 
-	if err := eng.cmd.Start(); err != nil {
+	e.exited = make(chan struct{})
+	go func() {
+		e.waitErr = e.cmd.Wait()
+
+		// all output has been written once Wait returns, so an unterminated
+		// last line, e.g. from an engine that crashed, can be sent on before
+		// the parser is told there is no more output
+		e.stream.Flush()
+		close(e.stdout)
+		close(e.exited)
+	}()
+
+	if err = e.startStdoutParsing(); err != nil {
+		e.cmd.Process.Kill()
+		<-e.exited
 		return nil, err
 	}
 
-	return &eng, nil
+	return e, nil
 }
 
 // EngConfig holds the information specified in the config file
 type EngConfig []struct {
-	DisplayName string   `json:"displayName"` // name to display for the engine
-	Path        string   `json:"path"`        // path to engine executable
-	InfoBufCap  int      `json:"infoBufCap"`  // max capacity for the info buffer
-	LineBufSize int      `json:"lineBufSize"` // buffer size for engine stdout
-	Args        []string `json:"args"`        // arguments passed to the engine on startup
-	UCIOptions  []struct {
+	DisplayName    string   `json:"displayName"`    // name to display for the engine
+	Path           string   `json:"path"`           // path to engine executable
+	InfoBufCap     int      `json:"infoBufCap"`     // max capacity for the info buffer
+	LineBufSize    int      `json:"lineBufSize"`    // buffer size for engine stdout
+	StdoutChanSize int      `json:"stdoutChanSize"` // lines buffered between engine stdout and the parser
+	Args           []string `json:"args"`           // arguments passed to the engine on startup
+	ReadyTimeout   int      `json:"readyTimeout"`   // ms to wait for uciok and readyok, 0 for the default
+	UCIOptions     []struct {
 		Name  string `json:"name"`  // name of engine option
 		Value string `json:"value"` // value of engine option
 	}
+
+	// named option sets applied with ApplyPreset, e.g. "analysis" or "blitz"
+	Presets map[string][]struct {
+		Name  string `json:"name"`  // name of engine option
+		Value string `json:"value"` // value of engine option
+	} `json:"presets"`
 }
 
 // parses the specified config file
@@ -668,6 +1649,10 @@ func (ec *EngConfig) parseConfig(filename string) error {
 			return errors.New("no path specified for engine in config file")
 		}
 
+		if c.ReadyTimeout < 0 {
+			return errors.New("negative readyTimeout for engine in config file")
+		}
+
 		for _, o := range c.UCIOptions {
 			if o.Name == "" && o.Value != "" {
 				return errors.New("engine option value specified without name")
@@ -678,38 +1663,147 @@ func (ec *EngConfig) parseConfig(filename string) error {
 	return nil
 }
 
+// ConfigOptions control how engines are set up from a config file
+type ConfigOptions struct {
+	// how long to wait for each engine to answer uci and isready, unless the
+	// engine's config sets readyTimeout. If zero, 5 seconds is used
+	ReadyTimeout time.Duration
+
+	// if true, an engine that fails to start does not stop the remaining
+	// engines from being set up
+	ContinueOnError bool
+}
+
+// EngineConfigError describes an engine from a config file that could not be
+// set up
+type EngineConfigError struct {
+	Index       int    // position of the engine in the config file
+	DisplayName string // display name given in the config file
+	Path        string // path to the engine executable
+	Err         error  // the reason the engine could not be set up
+}
+
+func (e *EngineConfigError) Error() string {
+	name := e.DisplayName
+	if name == "" {
+		name = e.Path
+	}
+
+	return fmt.Sprintf("engine %d (%s): %v", e.Index, name, e.Err)
+}
+
+func (e *EngineConfigError) Unwrap() error {
+	return e.Err
+}
+
 // NewEnginesFromConfig sets up all engines described in a JSON config file
 func NewEnginesFromConfig(path string) ([]*Engine, error) {
+	return NewEnginesFromConfigWithOptions(path, ConfigOptions{})
+}
+
+// NewEnginesFromConfigWithOptions sets up all engines described in a JSON
+// config file
+//
+// Errors setting up an engine are returned as an *EngineConfigError. If
+// opts.ContinueOnError is set, the engines that were set up are returned along
+// with the errors of those that were not, joined with errors.Join
+func NewEnginesFromConfigWithOptions(path string, opts ConfigOptions) ([]*Engine, error) {
 	config := EngConfig{}
 	engs := []*Engine{}
+	var errs []error
 
 	if err := config.parseConfig(path); err != nil {
 		return nil, err
 	}
 
-	for _, c := range config {
-		eng, err := NewEngineFromPath(c.Path, c.DisplayName,
-			c.InfoBufCap, c.LineBufSize, c.Args...)
-		if err != nil {
-			return nil, err
+	defaultTimeout := opts.ReadyTimeout
+	if defaultTimeout <= 0 {
+		defaultTimeout = defaultReadyTimeout
+	}
+
+	// engines already set up are closed before returning an error
+	closeAll := func() {
+		for _, eng := range engs {
+			eng.Close()
 		}
+	}
 
-		if err = eng.UCI(); err != nil {
-			return nil, err
+	for i, c := range config {
+		timeout := defaultTimeout
+		if c.ReadyTimeout > 0 {
+			timeout = time.Duration(c.ReadyTimeout) * time.Millisecond
 		}
 
-		for _, o := range c.UCIOptions {
-			if err = eng.SendOption(o.Name, o.Value); err != nil {
+		setup := func() (eng *Engine, err error) {
+			eng, err = NewEngineWithOptions(c.Path, EngineOptions{
+				DisplayName:    c.DisplayName,
+				InfoBufCap:     c.InfoBufCap,
+				LineBufSize:    c.LineBufSize,
+				StdoutChanSize: c.StdoutChanSize,
+			}, c.Args...)
+			if err != nil {
 				return nil, err
 			}
+
+			// don't leave a half set up engine running
+			defer func() {
+				if err != nil {
+					eng.Close()
+					eng = nil
+				}
+			}()
+
+			if err = eng.uci(timeout); err != nil {
+				return
+			}
+
+			for _, o := range c.UCIOptions {
+				if err = eng.SendOption(o.Name, o.Value); err != nil {
+					return
+				}
+			}
+
+			// a preset is only sent when applied, so check it now to report
+			// mistakes in the config at startup
+			for name, preset := range c.Presets {
+				presetOpts := make([]EngOption, len(preset))
+				for j, o := range preset {
+					presetOpts[j] = EngOption{Name: o.Name, Value: o.Value}
+
+					eng.RLock()
+					err = eng.validateOption(presetOpts[j])
+					eng.RUnlock()
+					if err != nil {
+						err = fmt.Errorf("preset %q: %w", name, err)
+						return
+					}
+				}
+				eng.AddPreset(name, presetOpts)
+			}
+
+			err = eng.WaitReadyOK(timeout)
+			return
 		}
 
-		if err = eng.WaitReadyOK(5 * time.Second); err != nil {
-			return nil, err
+		eng, err := setup()
+		if err != nil {
+			err = &EngineConfigError{
+				Index:       i,
+				DisplayName: c.DisplayName,
+				Path:        c.Path,
+				Err:         err,
+			}
+			if !opts.ContinueOnError {
+				closeAll()
+				return nil, err
+			}
+
+			errs = append(errs, err)
+			continue
 		}
 
 		engs = append(engs, eng)
 	}
 
-	return engs, nil
+	return engs, errors.Join(errs...)
 }
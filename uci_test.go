@@ -18,8 +18,21 @@ this program.  If not, see <https://www.gnu.org/licenses/>.
 package uci
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type ConfigTTOutput struct {
@@ -65,3 +78,1376 @@ func TestNewEngines(t *testing.T) {
 		})
 	}
 }
+
+func TestInfoRaw(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	lines := []string{
+		"info depth 1 seldepth 1 score cp 20 nodes 20 nps 20000 time 1 pv e2e4",
+		"info depth 2 currmove d2d4 currmovenumber 2",
+		"info string NNUE evaluation enabled\n",
+	}
+	feedLines(t, eng, lines...)
+
+	info := eng.GetInfo(-1)
+	if len(info) != len(lines) {
+		t.Fatalf("expected %d info lines, got %d", len(lines), len(info))
+	}
+
+	for i, l := range lines {
+		if info[i].Raw != l {
+			t.Errorf("expected raw line %q, got %q", l, info[i].Raw)
+		}
+	}
+
+	if info[1].CurrMove != "d2d4" {
+		t.Errorf("raw line does not match parsed info %+v", info[1])
+	}
+}
+
+func TestParseInfoString(t *testing.T) {
+	tt := []struct {
+		name string
+		line string
+		str  string
+	}{
+		{name: "message", line: "info string NNUE evaluation enabled", str: "NNUE evaluation enabled"},
+		{name: "leading spaces", line: "info string   indented", str: "  indented"},
+		{name: "inner and trailing spaces", line: "info string a  b  ", str: "a  b  "},
+		{name: "after other fields", line: "info depth 3 string  x", str: " x"},
+		{name: "keywords in the message", line: "info string depth 5 pv", str: "depth 5 pv"},
+		{name: "empty", line: "info string", str: ""},
+		{name: "newline terminated", line: "info string  spaced \n", str: " spaced "},
+		{name: "crlf terminated", line: "info string  spaced \r\n", str: " spaced "},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			eng, _ := newTestEngine()
+			feedLines(t, eng, tc.line)
+
+			info := eng.GetInfo(-1)
+			if len(info) != 1 {
+				t.Fatalf("expected 1 info line, got %d", len(info))
+			}
+			if info[0].String != tc.str {
+				t.Errorf("expected string %q, got %q", tc.str, info[0].String)
+			}
+			if tc.name == "keywords in the message" && info[0].Depth != 0 {
+				t.Errorf("expected keywords in the message not to be parsed, got depth %d", info[0].Depth)
+			}
+		})
+	}
+}
+
+func TestClearInfo(t *testing.T) {
+	eng, _ := newTestEngine()
+	eng.SetKeepInfoHistory(true)
+
+	feedLines(t, eng, depthLines(1, 5)...)
+	if n := len(eng.GetInfo(-1)); n != 5 {
+		t.Fatalf("expected 5 info lines, got %d", n)
+	}
+
+	eng.ClearInfo()
+	if info := eng.GetInfo(-1); len(info) != 0 {
+		t.Fatalf("expected no info lines after clearing, got %d", len(info))
+	}
+	if info := eng.GetInfo(3); len(info) != 0 {
+		t.Fatalf("expected no info lines after clearing, got %d", len(info))
+	}
+
+	// lines parsed afterwards are kept as usual
+	feedLines(t, eng, depthLines(6, 7)...)
+	info := eng.GetInfo(-1)
+	if len(info) != 2 || info[0].Depth != 6 {
+		t.Fatalf("expected depths 6 and 7, got %+v", info)
+	}
+}
+
+func TestInfoStringJoin(t *testing.T) {
+	lines := []string{
+		"info string NNUE evaluation using nn-0000000000a0.nnue \\",
+		"info string (133MiB, (22528, 3072, 15, 32, 1))",
+		"info string ready",
+		"info depth 1 score cp 10 pv e2e4",
+		"info string after a search line \\",
+		"bestmove e2e4",
+		"info string not continued",
+	}
+
+	// off by default, every line is its own message
+	eng, _ := newTestEngine()
+	feedLines(t, eng, lines...)
+	if n := len(eng.GetInfo(-1)); n != 6 {
+		t.Fatalf("expected 6 info lines without joining, got %d", n)
+	}
+
+	// lines ending in a backslash continue on the next
+	eng, _ = newTestEngine()
+	eng.SetInfoStringJoin(func(prev, next string) (string, bool) {
+		s, ok := strings.CutSuffix(prev, "\\")
+		return s + next, ok
+	})
+	feedLines(t, eng, lines...)
+
+	var messages []string
+	for _, info := range eng.GetInfo(-1) {
+		messages = append(messages, info.String)
+	}
+	expected := []string{
+		"NNUE evaluation using nn-0000000000a0.nnue (133MiB, (22528, 3072, 15, 32, 1))",
+		"ready",
+		"",
+		"after a search line \\",
+		"not continued",
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected messages %q, got %q", expected, messages)
+	}
+
+	raw := eng.GetInfo(-1)[0].Raw
+	if raw != lines[0]+"\n"+lines[1] {
+		t.Errorf("expected the raw lines to be kept, got %q", raw)
+	}
+
+	// the rule may use the engine
+	eng, _ = newTestEngine()
+	eng.SetInfoStringJoin(func(prev, next string) (string, bool) {
+		last := eng.GetInfo(1)
+		return prev + next, len(last) == 1 && len(last[0].String) < 2
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, l := range []string{"info string a", "info string b", "info string c"} {
+			eng.parseStdout(l)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the join rule deadlocked calling the engine")
+	}
+
+	messages = nil
+	for _, info := range eng.GetInfo(-1) {
+		messages = append(messages, info.String)
+	}
+	if expected = []string{"ab", "c"}; !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected messages %q, got %q", expected, messages)
+	}
+}
+
+func TestParseUTF8(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	// a no-break space, a non-ASCII path and an invalid byte
+	feedLines(t, eng,
+		"id name Größter\u00a0Zug 2.0",
+		"id author Ærøskøbing  Schachverein",
+		"info depth 2 score cp 5 string Netz geladen: /home/jörg/netze/λ-42.pb.gz \xff ok",
+		"info depth 3 string 評価関数を読み込みました",
+	)
+
+	eng.RLock()
+	name, author := eng.name, eng.author
+	eng.RUnlock()
+	if name != "Größter\u00a0Zug 2.0" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if author != "Ærøskøbing  Schachverein" {
+		t.Errorf("unexpected author %q", author)
+	}
+
+	info := eng.GetInfo(-1)
+	if len(info) != 2 {
+		t.Fatalf("expected 2 info lines, got %d", len(info))
+	}
+	if s := info[0].String; s != "Netz geladen: /home/jörg/netze/λ-42.pb.gz \xff ok" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if info[0].Depth != 2 || info[0].Score.Val != 5 {
+		t.Errorf("expected depth 2 and score 5, got %+v", info[0])
+	}
+	if s := info[1].String; s != "評価関数を読み込みました" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestBanner(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng,
+		"Stockfish 16 by the Stockfish developers (see AUTHORS file)",
+		"compiled with depth 5 support",
+		"id name Stockfish 16",
+		"id author the Stockfish developers",
+		"option name Hash type spin default 16 min 1 max 33554432",
+		"uciok",
+		"info depth 1 score cp 20 pv e2e4",
+	)
+
+	banner := []string{
+		"Stockfish 16 by the Stockfish developers (see AUTHORS file)",
+		"compiled with depth 5 support",
+	}
+	if b := eng.Banner(); !reflect.DeepEqual(b, banner) {
+		t.Errorf("expected banner %q, got %q", banner, b)
+	}
+
+	info := eng.GetInfo(-1)
+	if len(info) != 1 || info[0].Depth != 1 {
+		t.Fatalf("expected the banner to be kept out of the info buffer, got %+v", info)
+	}
+	if eng.name != "Stockfish 16" {
+		t.Errorf("unexpected name %q", eng.name)
+	}
+}
+
+func TestHandshakeInfo(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	errc := make(chan error)
+	go func() { errc <- eng.UCI() }()
+
+	for !strings.Contains(stdin.String(), "uci\n") {
+		time.Sleep(time.Millisecond)
+	}
+
+	feedLines(t, eng,
+		"id name Lc0 v0.30.0",
+		"option name Threads type spin default 2 min 1 max 128",
+		"info string Found pb network file: ./weights.pb.gz",
+		"info string Creating backend [cuda-auto]...",
+		"option name Hash type spin default 16 min 1 max 1024",
+		"uciok",
+	)
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected UCI to return once uciok is received")
+	}
+
+	banner := []string{
+		"info string Found pb network file: ./weights.pb.gz",
+		"info string Creating backend [cuda-auto]...",
+	}
+	if b := eng.Banner(); !reflect.DeepEqual(b, banner) {
+		t.Errorf("expected banner %q, got %q", banner, b)
+	}
+	if info := eng.GetInfo(-1); len(info) != 0 {
+		t.Errorf("expected no info lines from the handshake, got %+v", info)
+	}
+	if opts := eng.GetDefaultOptions(); len(opts) != 2 {
+		t.Errorf("expected 2 options, got %+v", opts)
+	}
+
+	// after the handshake info lines are parsed as normal
+	feedLines(t, eng, "info string NNUE evaluation enabled")
+	if info := eng.GetInfo(-1); len(info) != 1 || info[0].String != "NNUE evaluation enabled" {
+		t.Errorf("expected the info string to be parsed, got %+v", info)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	if err := eng.uci(20 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	// the handshake is over, so its late output is parsed as normal and its
+	// uciok answers nothing
+	feedLines(t, eng, "info string late", "uciok")
+	if info := eng.GetInfo(-1); len(info) != 1 || info[0].String != "late" {
+		t.Errorf("expected the info string to be parsed, got %+v", info)
+	}
+	if len(eng.chans.uciOK) != 0 {
+		t.Error("expected the late uciok to be dropped")
+	}
+
+	stdin.Reset()
+	errc := make(chan error)
+	go func() { errc <- eng.UCI() }()
+
+	for !strings.Contains(stdin.String(), "uci\n") {
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-errc:
+		t.Fatalf("expected the retried handshake to wait for its uciok, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	feedLines(t, eng, "option name Hash type spin default 16 min 1 max 1024", "uciok")
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected UCI to return once uciok is received")
+	}
+	if opts := eng.GetDefaultOptions(); len(opts) != 1 {
+		t.Errorf("expected 1 option, got %+v", opts)
+	}
+}
+
+func TestIgnoreEchoes(t *testing.T) {
+	search := func(eng *Engine) []Info {
+		t.Helper()
+
+		if err := eng.UCI(); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.SendFEN("8/8/8/8/8/8/8/K1k5 w - - 0 1"); err != nil {
+			t.Fatal(err)
+		}
+		h, err := eng.StartSearch(GoParams{Depth: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = h.Wait(5 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		return eng.GetInfo(-1)
+	}
+
+	// the echoed go command is parsed as an info line, along with the
+	// position command if it was parsed after the search started
+	info := search(newMockEngine(t, "echo"))
+	echoed := false
+	for _, line := range info {
+		if line.Raw == "go depth 2" && line.Depth == 2 {
+			echoed = true
+		}
+	}
+	if !echoed {
+		t.Fatalf("expected the echoed go command to be parsed, got %+v", info)
+	}
+
+	eng := newMockEngine(t, "echo")
+	eng.SetIgnoreEchoes(true)
+
+	info = search(eng)
+	if len(info) != 2 {
+		t.Fatalf("expected only the search's info lines, got %+v", info)
+	}
+	for i, line := range info {
+		if line.Depth != i+1 || len(line.PV) == 0 {
+			t.Errorf("line %d: unexpected %+v", i, line)
+		}
+	}
+	if b := eng.Banner(); len(b) != 0 {
+		t.Errorf("expected the echoed uci command to be ignored, got banner %q", b)
+	}
+}
+
+func TestSendCommandConcurrent(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	eng, _ := newTestEngine()
+	// a small buffer forces commands to be split across several writes
+	eng.stdin = bufio.NewWriterSize(pw, 16)
+
+	const goroutines = 8
+	const commands = 200
+
+	expected := map[string]bool{}
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < commands; i++ {
+			expected[fmt.Sprintf("setoption name Worker%d value %d", g, i)] = true
+		}
+	}
+
+	read := make(chan []string)
+	go func() {
+		var lines []string
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		read <- lines
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < commands; i++ {
+				cmd := fmt.Sprintf("setoption name Worker%d value %d", g, i)
+				if err := eng.SendCommand(cmd); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	pw.Close()
+
+	lines := <-read
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d commands, got %d", len(expected), len(lines))
+	}
+	for _, l := range lines {
+		if !expected[l] {
+			t.Fatalf("garbled command %q", l)
+		}
+		delete(expected, l)
+	}
+}
+
+func TestSendRaw(t *testing.T) {
+	eng, stdin := newTestEngine()
+
+	raw := []byte("bench 16 1 6\r\nd\n\x00go depth")
+	if err := eng.SendRaw(raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdin.String(); got != string(raw) {
+		t.Fatalf("expected %q, got %q", raw, got)
+	}
+
+	// line-oriented commands still follow on their own line
+	if err := eng.SendRaw([]byte(" 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.SendCommand("stop"); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdin.String(); got != string(raw)+" 1\nstop\n" {
+		t.Errorf("unexpected stdin %q", got)
+	}
+
+	// writes fail once the engine has closed its end of the pipe
+	pr, pw := io.Pipe()
+	pr.Close()
+	eng.stdin = bufio.NewWriter(pw)
+	if err := eng.SendRaw([]byte("uci\n")); !errors.Is(err, ErrEngineExited) {
+		t.Errorf("expected ErrEngineExited, got %v", err)
+	}
+}
+
+func TestBestMoveDelivery(t *testing.T) {
+	search := func(e *Engine, move string) {
+		t.Helper()
+		if err := e.Go(GoParams{Depth: 1}); err != nil {
+			t.Fatal(err)
+		}
+		feedLines(t, e, "info depth 1 score cp 0 pv "+move, "bestmove "+move)
+	}
+
+	// by default only the latest bestmove is kept
+	eng, _ := newTestEngine()
+	search(eng, "e2e4")
+	search(eng, "d2d4")
+
+	b, err := eng.WaitBestMove(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "d2d4" {
+		t.Fatalf("expected latest bestmove d2d4, got %s", b.BestMove)
+	}
+	if _, err = eng.WaitBestMove(10 * time.Millisecond); err == nil {
+		t.Fatal("expected the earlier bestmove to have been discarded")
+	}
+
+	// when queueing, both searches are returned in order
+	eng, _ = newTestEngine()
+	eng.SetQueueBestMoves(true)
+	search(eng, "e2e4")
+	search(eng, "d2d4")
+
+	for _, want := range []string{"e2e4", "d2d4"} {
+		b, err := eng.WaitBestMove(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.BestMove != want {
+			t.Fatalf("expected bestmove %s, got %s", want, b.BestMove)
+		}
+	}
+
+	// a full queue drops the oldest result
+	for i := 0; i < bestmoveQueueSize+1; i++ {
+		feedLines(t, eng, fmt.Sprintf("bestmove a2a%d", i%6+3))
+	}
+	b, err = eng.WaitBestMove(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "a2a4" {
+		t.Fatalf("expected oldest bestmove to be dropped, got %s first", b.BestMove)
+	}
+}
+
+func TestWaitBestMoveEngineExited(t *testing.T) {
+	eng := newMockEngine(t, "partial:info depth 3")
+
+	if err := eng.Go(GoParams{Depth: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := eng.WaitBestMove(30 * time.Second); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected WaitBestMove to return once the engine exited, took %v", d)
+	}
+
+	// a bestmove parsed before the engine exited is still delivered
+	eng = newMockEngine(t, "partial:bestmove d2d4")
+	if err := eng.Go(GoParams{Depth: 5}); err != nil {
+		t.Fatal(err)
+	}
+	<-eng.chans.parserDone
+
+	b, info, err := eng.WaitBestMoveWithInfo(time.Second)
+	if err != nil || b.BestMove != "d2d4" || info.Depth != 2 {
+		t.Fatalf("expected bestmove d2d4 after depth 2, got %+v, %+v, %v", b, info, err)
+	}
+	if _, err = eng.WaitBestMove(time.Second); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited once the bestmove was read, got %v", err)
+	}
+}
+
+func TestWaitBestMoveWithInfo(t *testing.T) {
+	eng := newMockEngine(t, "move:startpos=g1f3;cp 31")
+
+	if err := eng.SendStartPos(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Go(GoParams{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, info, err := eng.WaitBestMoveWithInfo(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BestMove != "g1f3" {
+		t.Errorf("expected bestmove g1f3, got %s", b.BestMove)
+	}
+	if info.Depth != 2 || info.Score.Val != 31 || len(info.PV) == 0 || info.PV[0] != "g1f3" {
+		t.Errorf("expected the depth 2 line for g1f3, got %+v", info)
+	}
+
+	// queued results each carry the info of their own search
+	eng2, _ := newTestEngine()
+	eng2.SetQueueBestMoves(true)
+	feedLines(t, eng2,
+		"info depth 1 score cp 10 pv e2e4",
+		"info depth 2 score cp 15 pv e2e4 e7e5",
+		"bestmove e2e4",
+		"bestmove d2d4",
+		"info depth 1 score cp -5 pv c7c5",
+		"bestmove c7c5",
+	)
+
+	expected := []struct {
+		move  string
+		depth int
+		raw   string
+	}{
+		{move: "e2e4", depth: 2, raw: "info depth 2 score cp 15 pv e2e4 e7e5"},
+		{move: "d2d4"},
+		{move: "c7c5", depth: 1, raw: "info depth 1 score cp -5 pv c7c5"},
+	}
+	for _, want := range expected {
+		b, info, err := eng2.WaitBestMoveWithInfo(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.BestMove != want.move || info.Depth != want.depth || info.Raw != want.raw {
+			t.Errorf("expected %s with %q, got %s with %q", want.move, want.raw, b.BestMove, info.Raw)
+		}
+	}
+}
+
+func TestParseBestMovePonder(t *testing.T) {
+	tt := []struct {
+		line string
+		want BestMove
+	}{
+		{line: "bestmove e2e4 ponder e7e5", want: BestMove{BestMove: "e2e4", Ponder: "e7e5"}},
+		{line: "bestmove e2e4", want: BestMove{BestMove: "e2e4"}},
+		{line: "bestmove (none)", want: BestMove{BestMove: "(none)"}},
+		{line: "bestmove (none) ponder (none)", want: BestMove{BestMove: "(none)"}},
+		{line: "bestmove 0000 ponder 0000", want: BestMove{BestMove: "0000"}},
+		{line: "bestmove e2e4 ponder", want: BestMove{BestMove: "e2e4"}},
+		{line: "bestmove  g1f3   ponder  g8f6", want: BestMove{BestMove: "g1f3", Ponder: "g8f6"}},
+		{
+			line: "bestmove e2e4 ponder e7e5 info something",
+			want: BestMove{BestMove: "e2e4", Ponder: "e7e5", Extra: []string{"info", "something"}},
+		},
+		{line: "bestmove e2e4 draw", want: BestMove{BestMove: "e2e4", Extra: []string{"draw"}}},
+		{
+			line: "bestmove e2e4 ponder (none) resign",
+			want: BestMove{BestMove: "e2e4", Extra: []string{"resign"}},
+		},
+	}
+
+	for _, tc := range tt {
+		eng, _ := newTestEngine()
+		feedLines(t, eng, tc.line)
+
+		b, err := eng.WaitBestMove(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(b, tc.want) {
+			t.Errorf("%q: expected %+v, got %+v", tc.line, tc.want, b)
+		}
+	}
+}
+
+func TestWaitReadyOKDuringSearch(t *testing.T) {
+	eng := newMockEngine(t)
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the info lines sent before readyok must still be collected
+	if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(eng.GetInfo(-1)); n != 2 {
+		t.Fatalf("expected 2 info lines from the running search, got %d", n)
+	}
+
+	// and the parser must still be running afterwards
+	if err := eng.SendStop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLateReadyOK(t *testing.T) {
+	// an engine whose answers are sent by hand
+	eng := &Engine{}
+	eng.stdin = bufio.NewWriter(io.Discard)
+	eng.stdout = make(chan string, defaultStdoutChanSize)
+	if err := eng.startStdoutParsing(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eng.WaitReadyOK(20 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// the readyok arrives after the wait gave up, and the parser must carry
+	// on with the lines that follow
+	sendLines(eng, append([]string{"readyok"}, depthLines(1, 3)...)...)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(eng.GetInfo(-1)) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(eng.GetInfo(-1)); n != 3 {
+		t.Fatalf("expected 3 info lines after the late readyok, got %d", n)
+	}
+
+	// the late readyok does not answer the next isready
+	done := make(chan error, 1)
+	go func() { done <- eng.WaitReadyOK(5 * time.Second) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected to wait for a new readyok, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sendLines(eng, "readyok")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	eng := newMockEngine(t)
+
+	rtt, err := eng.Ping(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rtt < 0 {
+		t.Fatalf("expected a non-negative round-trip time, got %v", rtt)
+	}
+
+	eng = newMockEngine(t, "noreadyok")
+	if _, err = eng.Ping(50 * time.Millisecond); err == nil {
+		t.Fatal("expected a timeout from an engine that does not answer isready")
+	}
+
+	// an engine exiting while it is waited for
+	time.AfterFunc(50*time.Millisecond, func() { eng.Signal(os.Kill) })
+	start := time.Now()
+	if _, err = eng.Ping(30 * time.Second); !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("expected ErrEngineExited, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("expected Ping to return once the engine exited, took %v", d)
+	}
+}
+
+func TestStdoutChanSize(t *testing.T) {
+	eng, err := NewEngineWithOptions(os.Args[0], EngineOptions{StdoutChanSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	if c := cap(eng.stdout); c != 2 {
+		t.Fatalf("expected a stdout channel of capacity 2, got %d", c)
+	}
+
+	// the handshake sends more lines than the channel holds
+	if err = eng.UCI(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(eng.GetDefaultOptions()); n != len(mockOptions) {
+		t.Fatalf("expected %d options, got %d", len(mockOptions), n)
+	}
+
+	eng, err = NewEngineWithOptions(os.Args[0], EngineOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	if c := cap(eng.stdout); c != defaultStdoutChanSize {
+		t.Fatalf("expected the default stdout channel capacity, got %d", c)
+	}
+}
+
+func TestNewEngineFromCmd(t *testing.T) {
+	wrapper, err := exec.LookPath("env")
+	if err != nil {
+		t.Skip("no env program to wrap the engine with")
+	}
+
+	// run the engine through a wrapper, in its own directory
+	dir := t.TempDir()
+	cmd := exec.Command(wrapper, "UCI_WRAPPED=1", os.Args[0], "pidfile:engine.pid")
+	cmd.Dir = dir
+
+	eng, err := NewEngineFromCmd(cmd, "Wrapped", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	if err = eng.UCI(); err != nil {
+		t.Fatal(err)
+	}
+	if err = eng.Go(GoParams{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if args := eng.CommandLine(); len(args) == 0 || args[0] != wrapper {
+		t.Errorf("expected the engine to be run by %s, got %q", wrapper, args)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "engine.pid")); err != nil {
+		t.Errorf("expected the engine to run in the command's directory: %v", err)
+	}
+	if _, err = eng.Clone(); err == nil {
+		t.Error("expected an engine started from a command not to be cloned")
+	}
+
+	// commands that cannot be used
+	started := exec.Command(os.Args[0])
+	started.Stdout = io.Discard
+	if _, err = NewEngineFromCmd(started, "", 0, 0); err == nil {
+		t.Error("expected a command with stdout set to be rejected")
+	}
+	if _, err = NewEngineFromCmd(exec.Command(filepath.Join(dir, "missing")), "", 0, 0); err == nil {
+		t.Error("expected a command that cannot start to fail")
+	}
+}
+
+func TestStdinBufSize(t *testing.T) {
+	tt := []struct {
+		name     string
+		size     int
+		buffered bool
+	}{
+		{name: "default", size: 0, buffered: true},
+		{name: "sized", size: 64 << 10, buffered: true},
+		{name: "unbuffered", size: -1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			eng, err := NewEngineWithOptions(os.Args[0], EngineOptions{StdinBufSize: tc.size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { eng.Close() })
+
+			if _, ok := eng.stdin.(*bufio.Writer); ok != tc.buffered {
+				t.Fatalf("expected buffered %v, got %T", tc.buffered, eng.stdin)
+			}
+			if w, ok := eng.stdin.(*bufio.Writer); ok && tc.size > 0 && w.Size() != tc.size {
+				t.Errorf("expected a buffer of %d bytes, got %d", tc.size, w.Size())
+			}
+
+			// the handshake and a search only complete if the commands
+			// reach the engine
+			if err = eng.UCI(); err != nil {
+				t.Fatal(err)
+			}
+			if err = eng.Go(GoParams{Depth: 2}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = eng.WaitBestMove(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestUnbufferedBatchOptions(t *testing.T) {
+	eng, _ := newTestEngine()
+	counter := &countingWriter{}
+	eng.stdin = newStdinWriter(counter, -1)
+
+	if err := eng.SetBatchOptions(true); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Hash", "Threads", "MultiPV"} {
+		if err := eng.SendOption(name, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without a buffer nothing is held back
+	if counter.writes != 3 {
+		t.Errorf("expected 3 writes, got %d", counter.writes)
+	}
+	if err := eng.CommitOptions(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkSendCommand(b *testing.B) {
+	for _, size := range []int{0, -1} {
+		name := "buffered"
+		if size < 0 {
+			name = "unbuffered"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer pr.Close()
+			defer pw.Close()
+			go io.Copy(io.Discard, pr)
+
+			eng, _ := newTestEngine()
+			eng.stdin = newStdinWriter(pw, size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				eng.SendCommand("position startpos moves e2e4 e7e5 g1f3")
+			}
+		})
+	}
+}
+
+func TestStdoutPending(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	if n, c := eng.StdoutPending(); n != 0 || c != defaultStdoutChanSize {
+		t.Fatalf("expected 0 of %d lines pending, got %d of %d", defaultStdoutChanSize, n, c)
+	}
+
+	// the parser stalls on the engine lock, so the lines back up
+	eng.Lock()
+	for _, line := range depthLines(1, 10) {
+		eng.stdout <- line
+	}
+	time.Sleep(20 * time.Millisecond)
+	n, _ := eng.StdoutPending()
+	eng.Unlock()
+	if n < 9 {
+		t.Errorf("expected at least 9 lines pending while the parser is stalled, got %d", n)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for n, _ = eng.StdoutPending(); n > 0 && time.Now().Before(deadline); n, _ = eng.StdoutPending() {
+		time.Sleep(time.Millisecond)
+	}
+	if n != 0 {
+		t.Errorf("expected the pending lines to be parsed, %d left", n)
+	}
+}
+
+func TestDuplicateStatusLines(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, l := range []string{
+			"uciok",
+			"uciok",
+			"readyok",
+			"readyok",
+			"info depth 4 score cp 12 pv e2e4",
+		} {
+			if err := eng.parseStdout(l); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("parser blocked on unawaited status lines")
+	}
+
+	if info := eng.GetInfo(-1); len(info) != 1 || info[0].Depth != 4 {
+		t.Fatalf("expected parsing to continue, got %+v", info)
+	}
+}
+
+func TestParseLargeCounters(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng, "info depth 40 nodes 12345678901 nps 98765432109 "+
+		"tbhits 4294967296 sbhits 2147483648 time 3000000000 pv e2e4")
+
+	info := eng.GetInfo(-1)[0]
+	if info.Nodes != 12345678901 {
+		t.Errorf("expected nodes 12345678901, got %d", info.Nodes)
+	}
+	if info.NodesPerSecond != 98765432109 {
+		t.Errorf("expected nps 98765432109, got %d", info.NodesPerSecond)
+	}
+	if info.TBHits != 4294967296 {
+		t.Errorf("expected tbhits 4294967296, got %d", info.TBHits)
+	}
+	if info.SBHits != 2147483648 {
+		t.Errorf("expected sbhits 2147483648, got %d", info.SBHits)
+	}
+	if info.Time != 3000000000 {
+		t.Errorf("expected time 3000000000, got %d", info.Time)
+	}
+}
+
+func TestInfoDuration(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	feedLines(t, eng, "info depth 12 nodes 1000000 time 1500 pv e2e4")
+
+	info := eng.GetInfo(1)[0]
+	if d := info.Duration(); d != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s, got %v", d)
+	}
+	if info.Time != 1500 {
+		t.Errorf("expected the raw time to be kept, got %d", info.Time)
+	}
+}
+
+func TestInfoNPS(t *testing.T) {
+	tt := []struct {
+		line string
+		nps  int64
+	}{
+		{line: "info depth 10 nodes 150000 nps 1200000 time 100 pv e2e4", nps: 1200000},
+		{line: "info depth 10 nodes 150000 time 100 pv e2e4", nps: 1500000},
+		{line: "info depth 1 nodes 20 time 0 pv e2e4", nps: 0},
+		{line: "info depth 1 time 5 pv e2e4", nps: 0},
+		{line: "info depth 1 pv e2e4", nps: 0},
+	}
+
+	for _, tc := range tt {
+		eng, _ := newTestEngine()
+		feedLines(t, eng, tc.line)
+
+		if nps := eng.GetInfo(1)[0].NPS(); nps != tc.nps {
+			t.Errorf("%q: expected nps %d, got %d", tc.line, tc.nps, nps)
+		}
+	}
+}
+
+func TestInfoHashFullPercent(t *testing.T) {
+	tt := []struct {
+		line     string
+		hashFull int
+		percent  float64
+	}{
+		{line: "info depth 12 hashfull 734 pv e2e4", hashFull: 734, percent: 73.4},
+		{line: "info depth 1 hashfull 0 pv e2e4", hashFull: 0, percent: 0},
+		{line: "info depth 40 hashfull 1000 pv e2e4", hashFull: 1000, percent: 100},
+		{line: "info depth 9 hashfull 5 pv e2e4", hashFull: 5, percent: 0.5},
+		{line: "info depth 9 hashfull 1200 pv e2e4", hashFull: 1200, percent: 100},
+		{line: "info depth 1 pv e2e4", hashFull: 0, percent: 0},
+	}
+
+	for _, tc := range tt {
+		info, err := parseInfo(tc.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.HashFull != tc.hashFull {
+			t.Errorf("%q: expected hashfull %d, got %d", tc.line, tc.hashFull, info.HashFull)
+		}
+		if p := info.HashFullPercent(); p != tc.percent {
+			t.Errorf("%q: expected %v%%, got %v%%", tc.line, tc.percent, p)
+		}
+	}
+}
+
+func TestScoreMateIn(t *testing.T) {
+	tt := []struct {
+		line      string
+		val       int
+		moves     int
+		favorable bool
+		ok        bool
+	}{
+		{line: "info depth 20 score mate 5 pv h5f7", val: 5, moves: 5, favorable: true, ok: true},
+		{line: "info depth 20 score mate -1 pv g8h8", val: -1, moves: 1, favorable: false, ok: true},
+		{line: "info depth 245 score mate 3000 pv a1a2", val: 3000, moves: 3000, favorable: true, ok: true},
+		{line: "info depth 245 score mate -3000 pv a1a2", val: -3000, moves: 3000, favorable: false, ok: true},
+		{line: "info depth 0 score mate 0", val: 0, moves: 0, favorable: false, ok: true},
+		{line: "info depth 20 score cp -5 pv e2e4", val: -5, ok: false},
+	}
+
+	for _, tc := range tt {
+		eng, _ := newTestEngine()
+		feedLines(t, eng, tc.line)
+
+		score := eng.GetInfo(1)[0].Score
+		if score.Val != tc.val {
+			t.Errorf("%q: expected val %d, got %d", tc.line, tc.val, score.Val)
+		}
+
+		moves, favorable, ok := score.MateIn()
+		if moves != tc.moves || favorable != tc.favorable || ok != tc.ok {
+			t.Errorf("%q: expected (%d, %t, %t), got (%d, %t, %t)", tc.line,
+				tc.moves, tc.favorable, tc.ok, moves, favorable, ok)
+		}
+	}
+}
+
+func TestScoreString(t *testing.T) {
+	tt := []struct {
+		score Score
+		str   string
+	}{
+		{score: Score{Val: 123}, str: "+1.23"},
+		{score: Score{Val: -5}, str: "-0.05"},
+		{score: Score{Val: 0}, str: "0.00"},
+		{score: Score{Val: -1000}, str: "-10.00"},
+		{score: Score{Val: 4, Mate: true}, str: "#4"},
+		{score: Score{Val: -2, Mate: true}, str: "#-2"},
+		{score: Score{Val: 35, Lowerbound: true}, str: "+0.35↑"},
+		{score: Score{Val: -210, Upperbound: true}, str: "-2.10↓"},
+		{score: Score{Val: 7, Mate: true, Lowerbound: true}, str: "#7↑"},
+	}
+
+	for _, tc := range tt {
+		if s := tc.score.String(); s != tc.str {
+			t.Errorf("%+v: expected %q, got %q", tc.score, tc.str, s)
+		}
+	}
+}
+
+func TestInfoReceived(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	start := time.Now()
+	feedLines(t, eng, depthLines(1, 10)...)
+
+	info := eng.GetInfo(-1)
+	if len(info) != 10 {
+		t.Fatalf("expected 10 info lines, got %d", len(info))
+	}
+
+	prev := start
+	for _, line := range info {
+		if line.Received.IsZero() {
+			t.Fatalf("depth %d: expected the receive time to be set", line.Depth)
+		}
+		if line.Received.Before(prev) {
+			t.Errorf("depth %d: received at %v, before the previous line at %v",
+				line.Depth, line.Received, prev)
+		}
+		prev = line.Received
+	}
+}
+
+func TestParseInfoUnknownTokens(t *testing.T) {
+	tt := []struct {
+		name  string
+		line  string
+		depth int
+		pv    []string
+		extra map[string]string
+	}{
+		{
+			name:  "unknown token before depth",
+			line:  "info foo 42 depth 10",
+			depth: 10,
+			extra: map[string]string{"foo": "42"},
+		},
+		{
+			name:  "unknown token with several values",
+			line:  "info depth 12 wdl 350 500 150 nodes 1000 pv e2e4 e7e5",
+			depth: 12,
+			pv:    []string{"e2e4", "e7e5"},
+			extra: map[string]string{"wdl": "350 500 150"},
+		},
+		{
+			name:  "unknown flag without a value",
+			line:  "info experimental depth 3",
+			depth: 3,
+			extra: map[string]string{"experimental": ""},
+		},
+		{
+			name:  "no unknown tokens",
+			line:  "info depth 7 score cp 13 lowerbound pv d2d4",
+			depth: 7,
+			pv:    []string{"d2d4"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := parseInfo(tc.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Depth != tc.depth {
+				t.Errorf("expected depth %d, got %d", tc.depth, info.Depth)
+			}
+			if !reflect.DeepEqual(info.PV, tc.pv) {
+				t.Errorf("expected pv %v, got %v", tc.pv, info.PV)
+			}
+			if !reflect.DeepEqual(info.Extra, tc.extra) {
+				t.Errorf("expected extra %v, got %v", tc.extra, info.Extra)
+			}
+		})
+	}
+}
+
+func TestParseInfoLc0(t *testing.T) {
+	line := "info depth 12 seldepth 30 time 1503 nodes 2345 score cp 27 wdl 412 402 186 " +
+		"hashfull 10 nps 1560.5 tbhits 0 movesleft 60 wv 0.226 pv e2e4 e7e5 g1f3"
+
+	info, err := parseInfo(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Depth != 12 || info.SelDepth != 30 || info.Time != 1503 || info.Nodes != 2345 {
+		t.Errorf("unexpected search counters %+v", info)
+	}
+	if info.NodesPerSecond != 1560 {
+		t.Errorf("expected nps to be truncated to 1560, got %d", info.NodesPerSecond)
+	}
+	if info.Score.Val != 27 || info.HashFull != 10 {
+		t.Errorf("expected score 27 and hashfull 10, got %+v", info)
+	}
+	if !reflect.DeepEqual(info.PV, []string{"e2e4", "e7e5", "g1f3"}) {
+		t.Errorf("unexpected pv %v", info.PV)
+	}
+
+	extra := map[string]string{"wdl": "412 402 186", "movesleft": "60", "wv": "0.226"}
+	if !reflect.DeepEqual(info.Extra, extra) {
+		t.Errorf("expected extra %v, got %v", extra, info.Extra)
+	}
+
+	// floats are truncated towards zero, not rounded
+	if info, err = parseInfo("info depth 3 score cp -14.9 time 12.99"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Score.Val != -14 || info.Time != 12 {
+		t.Errorf("expected score -14 and time 12, got %+v", info)
+	}
+
+	for _, bad := range []string{"info nps 1e30", "info nps NaN", "info depth 1.5x"} {
+		if _, err := parseInfo(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestParseInfoRefutation(t *testing.T) {
+	tt := []struct {
+		name       string
+		line       string
+		refutation Refutation
+		err        bool
+	}{
+		{
+			name:       "refuting line",
+			line:       "info refutation d1h5 g6h5",
+			refutation: Refutation{Move: "d1h5", Line: []string{"g6h5"}},
+		},
+		{
+			name:       "no refuting line",
+			line:       "info refutation d1h5",
+			refutation: Refutation{Move: "d1h5"},
+		},
+		{
+			name: "no refutation",
+			line: "info depth 3 pv e2e4",
+		},
+		{
+			name: "missing move",
+			line: "info depth 3 refutation",
+			err:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := parseInfo(tc.line)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(info.Refutation, tc.refutation) {
+				t.Errorf("expected refutation %+v, got %+v", tc.refutation, info.Refutation)
+			}
+		})
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	var buf bytes.Buffer
+	eng.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if err := eng.SendCommand("uci"); err != nil {
+		t.Fatal(err)
+	}
+	feedLines(t, eng, "id name Mock Engine")
+
+	// a line that cannot be parsed is logged, and parsing carries on
+	sendLines(eng, "info depth x")
+	if err := eng.WaitReadyOK(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`level=DEBUG msg="sent command" command=uci`,
+		`level=DEBUG msg="received line" line="id name Mock Engine"`,
+		`level=ERROR msg="parsing engine output" line="info depth x"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+// writes a config file for mock engines, one per set of arguments, and
+// returns its path
+func writeMockConfig(t *testing.T, entries ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "engines.json")
+	config := "[" + strings.Join(entries, ",") + "]"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// returns a config file entry for a mock engine
+func mockConfigEntry(name string, readyTimeout int, args ...string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+
+	return fmt.Sprintf(`{"displayName": %q, "path": %q, "readyTimeout": %d, "args": [%s]}`,
+		name, os.Args[0], readyTimeout, strings.Join(quoted, ","))
+}
+
+func TestNewEnginesFromConfigContinueOnError(t *testing.T) {
+	path := writeMockConfig(t,
+		mockConfigEntry("first", 0),
+		mockConfigEntry("slow", 100, "noreadyok"),
+		mockConfigEntry("third", 0),
+	)
+
+	start := time.Now()
+	engs, err := NewEnginesFromConfigWithOptions(path, ConfigOptions{ContinueOnError: true})
+	for _, eng := range engs {
+		eng.SendQuit()
+	}
+
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("the engine's readyTimeout was not used")
+	}
+
+	if len(engs) != 2 {
+		t.Fatalf("expected 2 engines, got %d", len(engs))
+	}
+	if engs[0].dName != "first" || engs[1].dName != "third" {
+		t.Fatalf("expected engines first and third, got %s and %s", engs[0].dName, engs[1].dName)
+	}
+
+	var cerr *EngineConfigError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected an *EngineConfigError, got %v", err)
+	}
+	if cerr.Index != 1 || cerr.DisplayName != "slow" {
+		t.Fatalf("expected engine 1 (slow) to fail, got %v", cerr)
+	}
+}
+
+func TestNewEnginesFromConfigTimeout(t *testing.T) {
+	path := writeMockConfig(t,
+		mockConfigEntry("first", 0),
+		mockConfigEntry("slow", 0, "noreadyok"),
+		mockConfigEntry("third", 0),
+	)
+
+	engs, err := NewEnginesFromConfigWithOptions(path, ConfigOptions{ReadyTimeout: 100 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if engs != nil {
+		t.Fatalf("expected no engines, got %d", len(engs))
+	}
+
+	var cerr *EngineConfigError
+	if !errors.As(err, &cerr) || cerr.Index != 1 {
+		t.Fatalf("expected engine 1 to fail, got %v", err)
+	}
+}
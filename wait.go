@@ -0,0 +1,383 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
+
+const (
+	// the number of info lines buffered for each subscriber
+	subscriberChanSize = 1024
+)
+
+// subscriber receives the info lines and bestmoves parsed while it is
+// subscribed. Lines are dropped if its buffers are full
+type subscriber struct {
+	info     chan Info
+	bestMove chan BestMove
+}
+
+// returns the info lines received during a search that are still in the
+// info buffer. The caller must hold the engine lock
+func (e *Engine) searchInfo(h *SearchHandle) []Info {
+	end := e.infoTotal
+	if h.infoEnd != 0 {
+		end = h.infoEnd
+	}
+
+	// position in the info buffer of a line, counted over all lines
+	pos := func(n uint64) int {
+		return len(e.infoBuf) - int(e.infoTotal-n)
+	}
+
+	first, last := pos(h.infoStart), pos(end)
+	if first < 0 {
+		first = 0
+	}
+	if last < first {
+		return []Info{}
+	}
+
+	ret := make([]Info, last-first)
+	copy(ret, e.infoBuf[first:last])
+
+	return ret
+}
+
+// subscribe registers a new subscriber, and returns it along with a function
+// that must be called to unsubscribe
+//
+// It also returns the info lines of the current search parsed before
+// subscribing. If there is no search in progress, the lines of the most
+// recently completed search are returned instead and ended is true
+func (e *Engine) subscribe() (sub *subscriber, current []Info, ended bool, unsubscribe func()) {
+	sub = &subscriber{
+		info:     make(chan Info, subscriberChanSize),
+		bestMove: make(chan BestMove, 1),
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if len(e.searches) > 0 {
+		current = e.searchInfo(e.searches[0])
+	} else if e.lastSearch != nil {
+		current = e.searchInfo(e.lastSearch)
+		ended = true
+	}
+
+	e.subscribers = append(e.subscribers, sub)
+
+	unsubscribe = func() {
+		e.Lock()
+		defer e.Unlock()
+
+		for i, s := range e.subscribers {
+			if s == sub {
+				e.subscribers = append(e.subscribers[:i], e.subscribers[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return sub, current, ended, unsubscribe
+}
+
+// sends a parsed info line to the current search and all subscribers. The
+// caller must hold the engine lock
+func (e *Engine) publishInfo(info Info) {
+	if len(e.searches) > 0 {
+		e.searches[0].sendInfo(info)
+	}
+
+	for _, s := range e.subscribers {
+		select {
+		case s.info <- info:
+		default:
+		}
+	}
+}
+
+// sends a bestmove to all subscribers and completes the oldest outstanding
+// search, which the bestmove ends. The caller must hold the engine lock
+func (e *Engine) publishBestMove(b BestMove) {
+	if len(e.searches) > 0 {
+		h := e.searches[0]
+		h.infoEnd = e.infoTotal
+		h.complete(b)
+
+		e.lastSearch = h
+		e.searches = e.searches[1:]
+		if len(e.searches) > 0 {
+			e.searches[0].infoStart = e.infoTotal
+		}
+	}
+
+	for _, s := range e.subscribers {
+		select {
+		case s.bestMove <- b:
+		default:
+		}
+	}
+}
+
+// ends every outstanding search with an error once the engine output is no
+// longer parsed, e.g. because the engine crashed during a search. No search
+// can be started afterwards
+func (e *Engine) endSearches() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.outputDone = true
+
+	for i, h := range e.searches {
+		if i == 0 {
+			h.infoEnd = e.infoTotal
+			e.lastSearch = h
+		}
+		h.fail(fmt.Errorf("search %d: %w", h.ID, ErrEngineExited))
+	}
+	e.searches = nil
+}
+
+// waitForInfo waits for the first info line of the current search satisfying
+// pred. If the search ends or the timeout expires first, the deepest info line
+// received is returned with an error. If no search is in progress, the most
+// recently completed search is checked instead
+func (e *Engine) waitForInfo(pred func(Info) bool, timeout time.Duration) (Info, error) {
+	sub, current, ended, unsubscribe := e.subscribe()
+	defer unsubscribe()
+
+	var deepest Info
+
+	// returns true if the info line satisfies pred
+	check := func(info Info) bool {
+		if pred(info) {
+			return true
+		}
+		if info.Depth >= deepest.Depth {
+			deepest = info
+		}
+		return false
+	}
+
+	for _, info := range current {
+		if check(info) {
+			return info, nil
+		}
+	}
+	if ended {
+		return deepest, ErrSearchEnded
+	}
+
+	timer := time.After(timeout)
+
+	for {
+		select {
+		case info := <-sub.info:
+			if check(info) {
+				return info, nil
+			}
+		case <-sub.bestMove:
+			// info lines sent before the bestmove are already buffered
+			for len(sub.info) > 0 {
+				if info := <-sub.info; check(info) {
+					return info, nil
+				}
+			}
+			return deepest, ErrSearchEnded
+		case <-e.chans.parserDone:
+			for len(sub.info) > 0 {
+				if info := <-sub.info; check(info) {
+					return info, nil
+				}
+			}
+			if len(sub.bestMove) > 0 {
+				return deepest, ErrSearchEnded
+			}
+			return deepest, ErrEngineExited
+		case <-timer:
+			return deepest, ErrTimeout
+		}
+	}
+}
+
+// WaitForDepth waits for the current search to reach at least the given depth
+// and returns the first info line that does. The search is not stopped; use
+// SendStop afterwards to end it early
+//
+// If the search ends or the timeout expires before reaching the depth, the
+// deepest info line received is returned along with an error
+func (e *Engine) WaitForDepth(depth int, timeout time.Duration) (Info, error) {
+	info, err := e.waitForInfo(func(i Info) bool {
+		return i.Depth >= depth
+	}, timeout)
+	if err != nil {
+		return info, fmt.Errorf("waiting for depth %d: %w", depth, err)
+	}
+
+	return info, nil
+}
+
+// WaitForScore waits for the first info line of the current search whose score
+// satisfies pred, for example a forced mate or an evaluation above a
+// threshold. Info lines without a score are skipped
+//
+// If the search ends or the timeout expires first, the deepest info line
+// received is returned along with an error
+func (e *Engine) WaitForScore(pred func(Score) bool, timeout time.Duration) (Info, error) {
+	info, err := e.waitForInfo(func(i Info) bool {
+		return i.hasScore && pred(i.Score)
+	}, timeout)
+	if err != nil {
+		return info, fmt.Errorf("waiting for score: %w", err)
+	}
+
+	return info, nil
+}
+
+// WaitForMate waits for the first info line of the current search reporting a
+// mate score. The number of moves to mate is in its Score.Val: positive if
+// the engine is mating, negative if it is getting mated
+//
+// If the search ends or the timeout expires first, the deepest info line
+// received is returned along with an error
+func (e *Engine) WaitForMate(timeout time.Duration) (Info, error) {
+	info, err := e.waitForInfo(func(i Info) bool {
+		return i.hasScore && i.Score.Mate
+	}, timeout)
+	if err != nil {
+		return info, fmt.Errorf("waiting for mate: %w", err)
+	}
+
+	return info, nil
+}
+
+// InfoSeq returns an iterator over the info lines of the current search,
+// starting with those already parsed. Iteration ends when the search ends
+// with a bestmove, the engine exits, ctx is cancelled, or the loop body breaks
+// out. If no search is in progress, the lines of the most recently completed
+// search are yielded
+//
+//	for info := range eng.InfoSeq(ctx) {
+//		fmt.Println(info.Depth, info.Score)
+//	}
+//
+// Lines are dropped if the loop body falls more than subscriberChanSize lines
+// behind the engine
+func (e *Engine) InfoSeq(ctx context.Context) iter.Seq[Info] {
+	return func(yield func(Info) bool) {
+		sub, current, ended, unsubscribe := e.subscribe()
+		defer unsubscribe()
+
+		for _, info := range current {
+			if !yield(info) {
+				return
+			}
+		}
+		if ended {
+			return
+		}
+
+		// yields the lines published before the search or the output ended
+		drain := func() {
+			for len(sub.info) > 0 {
+				if !yield(<-sub.info) {
+					return
+				}
+			}
+		}
+
+		for {
+			select {
+			case info := <-sub.info:
+				if !yield(info) {
+					return
+				}
+			case <-sub.bestMove:
+				drain()
+				return
+			case <-e.chans.parserDone:
+				drain()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// WaitUntilIdle waits until the current search has sent no info line for the
+// idle duration, e.g. to end an infinite analysis once it has settled, and
+// returns the deepest info line received. The search is not stopped; use
+// SendStop afterwards to end it
+//
+// If the search ends first, or the engine is still sending info lines once
+// max has passed, the deepest info line received is returned along with an
+// error
+func (e *Engine) WaitUntilIdle(idle, max time.Duration) (Info, error) {
+	sub, current, ended, unsubscribe := e.subscribe()
+	defer unsubscribe()
+
+	var deepest Info
+	update := func(info Info) {
+		if info.Depth >= deepest.Depth {
+			deepest = info
+		}
+	}
+
+	for _, info := range current {
+		update(info)
+	}
+	if ended {
+		return deepest, fmt.Errorf("waiting for idle: %w", ErrSearchEnded)
+	}
+
+	idleTimer := time.NewTimer(idle)
+	defer idleTimer.Stop()
+	maxTimer := time.After(max)
+
+	for {
+		select {
+		case info := <-sub.info:
+			update(info)
+			idleTimer.Reset(idle)
+		case <-sub.bestMove:
+			for len(sub.info) > 0 {
+				update(<-sub.info)
+			}
+			return deepest, fmt.Errorf("waiting for idle: %w", ErrSearchEnded)
+		case <-e.chans.parserDone:
+			for len(sub.info) > 0 {
+				update(<-sub.info)
+			}
+			if len(sub.bestMove) > 0 {
+				return deepest, fmt.Errorf("waiting for idle: %w", ErrSearchEnded)
+			}
+			return deepest, fmt.Errorf("waiting for idle: %w", ErrEngineExited)
+		case <-idleTimer.C:
+			return deepest, nil
+		case <-maxTimer:
+			return deepest, fmt.Errorf("waiting for idle: %w", ErrTimeout)
+		}
+	}
+}
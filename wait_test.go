@@ -0,0 +1,317 @@
+/*
+This file is part of the uci package.
+Copyright (C) 2018 David Hughes
+
+uci is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package uci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// returns info lines for depths first through last
+func depthLines(first, last int) []string {
+	var lines []string
+	for d := first; d <= last; d++ {
+		lines = append(lines, fmt.Sprintf("info depth %d score cp %d pv e2e4", d, d*10))
+	}
+	return lines
+}
+
+func TestWaitForDepth(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// lines parsed before waiting count towards the depth
+	feedLines(t, eng, depthLines(1, 2)...)
+	go sendLines(eng, depthLines(3, 8)...)
+
+	info, err := eng.WaitForDepth(5, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Depth != 5 {
+		t.Fatalf("expected depth 5, got %d", info.Depth)
+	}
+
+	sendLines(eng, "bestmove e2e4")
+	if _, err = eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// a search that ends before reaching the depth
+	if err = eng.Go(GoParams{Depth: 3}); err != nil {
+		t.Fatal(err)
+	}
+	go sendLines(eng, append(depthLines(1, 3), "bestmove e2e4")...)
+
+	info, err = eng.WaitForDepth(10, 5*time.Second)
+	if err == nil {
+		t.Fatal("expected an error when the search ends early")
+	}
+	if info.Depth != 3 {
+		t.Fatalf("expected the deepest info at depth 3, got %d", info.Depth)
+	}
+}
+
+func TestWaitForDepthTimeout(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	feedLines(t, eng, depthLines(1, 2)...)
+
+	info, err := eng.WaitForDepth(20, 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if info.Depth != 2 {
+		t.Fatalf("expected the deepest info at depth 2, got %d", info.Depth)
+	}
+}
+
+func TestWaitForDepthAfterSearch(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	// the search completes before waiting
+	if err := eng.Go(GoParams{Depth: 4}); err != nil {
+		t.Fatal(err)
+	}
+	feedLines(t, eng, append(depthLines(1, 4), "bestmove e2e4")...)
+
+	info, err := eng.WaitForDepth(3, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Depth != 3 {
+		t.Fatalf("expected depth 3, got %d", info.Depth)
+	}
+
+	start := time.Now()
+	info, err = eng.WaitForDepth(6, 5*time.Second)
+	if err == nil {
+		t.Fatal("expected an error for a depth the completed search did not reach")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expected to return immediately for a completed search")
+	}
+	if info.Depth != 4 {
+		t.Fatalf("expected the deepest info at depth 4, got %d", info.Depth)
+	}
+}
+
+func TestWaitForScore(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	go sendLines(eng,
+		"info depth 1 score cp 120 pv h5f7",
+		"info depth 2 currmove h5f7 currmovenumber 1",
+		"info depth 2 score cp 450 pv h5f7 e8e7",
+		"info depth 3 score mate 2 pv h5f7 e8e7 c4d5",
+		"info depth 4 score mate 2 pv h5f7 e8e7 c4d5",
+	)
+
+	info, err := eng.WaitForScore(func(s Score) bool { return s.Mate }, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Depth != 3 || !info.Score.Mate || info.Score.Val != 2 {
+		t.Fatalf("expected mate in 2 at depth 3, got %+v", info)
+	}
+
+	// lines without a score never satisfy the predicate
+	info, err = eng.WaitForScore(func(s Score) bool { return !s.Mate && s.Val == 0 }, 50*time.Millisecond)
+	if err == nil {
+		t.Fatalf("expected a timeout, got %+v", info)
+	}
+	if info.Depth != 4 {
+		t.Fatalf("expected the deepest info at depth 4, got %d", info.Depth)
+	}
+}
+
+func TestWaitForMate(t *testing.T) {
+	const mating = "r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4"
+	const mated = "6k1/5ppp/8/8/8/8/5PPP/3r2K1 w - - 0 1"
+
+	eng := newMockEngine(t,
+		"move:"+mating+"=h5f7;mate 3",
+		"move:"+mated+"=g1f1;mate -2",
+		"move:startpos=e2e4")
+
+	tt := []struct {
+		name string
+		pos  string
+		val  int
+	}{
+		{name: "mating", pos: mating, val: 3},
+		{name: "getting mated", pos: mated, val: -2},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := eng.SendFEN(tc.pos); err != nil {
+				t.Fatal(err)
+			}
+			h, err := eng.StartSearch(GoParams{Depth: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := eng.WaitForMate(5 * time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Score.Mate || info.Score.Val != tc.val {
+				t.Errorf("expected mate %d, got %+v", tc.val, info.Score)
+			}
+
+			if _, err := h.Wait(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// a search without a mate score ends without one
+	if err := eng.SendStartPos(); err != nil {
+		t.Fatal(err)
+	}
+	h, err := eng.StartSearch(GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := eng.WaitForMate(5 * time.Second); err == nil {
+		t.Errorf("expected an error, got %+v", info)
+	}
+	h.Wait(5 * time.Second)
+}
+
+func TestInfoSeq(t *testing.T) {
+	eng := newMockEngine(t)
+
+	h, err := eng.StartSearch(GoParams{Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var depths []int
+	for info := range eng.InfoSeq(context.Background()) {
+		depths = append(depths, info.Depth)
+	}
+	if !reflect.DeepEqual(depths, []int{1, 2}) {
+		t.Errorf("expected depths 1 and 2, got %v", depths)
+	}
+	if _, err = h.Wait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// cancelling ends an infinite search's iteration
+	if _, err = eng.StartSearch(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	for range eng.InfoSeq(ctx) {
+		if n++; n == 2 {
+			cancel()
+		}
+	}
+	if n != 2 {
+		t.Errorf("expected 2 lines before cancelling, got %d", n)
+	}
+
+	// breaking out unsubscribes
+	for range eng.InfoSeq(context.Background()) {
+		break
+	}
+	eng.RLock()
+	subscribers := len(eng.subscribers)
+	eng.RUnlock()
+	if subscribers != 0 {
+		t.Errorf("expected no subscribers to be left, got %d", subscribers)
+	}
+
+	if _, err = eng.StopAndWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitUntilIdle(t *testing.T) {
+	eng, _ := newTestEngine()
+
+	if err := eng.Go(GoParams{Infinite: true}); err != nil {
+		t.Fatal(err)
+	}
+	feedLines(t, eng, depthLines(1, 3)...)
+	go sendLines(eng, depthLines(4, 9)...)
+
+	// the lines stop after depth 9
+	start := time.Now()
+	info, err := eng.WaitUntilIdle(100*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Depth != 9 {
+		t.Errorf("expected the deepest info at depth 9, got %d", info.Depth)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 4*time.Second {
+		t.Errorf("expected to return once idle, returned after %v", elapsed)
+	}
+
+	// an engine that keeps sending lines is never idle
+	done := make(chan struct{})
+	go func() {
+		for d := 10; ; d++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				sendLines(eng, depthLines(d, d)...)
+			}
+		}
+	}()
+
+	info, err = eng.WaitUntilIdle(200*time.Millisecond, 300*time.Millisecond)
+	close(done)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if info.Depth < 10 {
+		t.Errorf("expected a line deeper than 9, got depth %d", info.Depth)
+	}
+
+	// a search that ends is not idle
+	sendLines(eng, "bestmove e2e4")
+	if _, err = eng.WaitBestMove(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = eng.WaitUntilIdle(time.Second, 5*time.Second); !errors.Is(err, ErrSearchEnded) {
+		t.Errorf("expected the search to have ended, got %v", err)
+	}
+}